@@ -2,13 +2,22 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/suricatatalk/gate/auth"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func authToken(c *gin.Context) {
 	token := c.Request.Header.Get(TokenHeader)
+	if len(token) == 0 {
+		// Websockets cannot set
+		// the header, so the query
+		// parameter is accepted
+		token = c.Query("token")
+	}
 	if len(token) == 0 {
 		log.Error("Token header not found")
 		c.AbortWithStatus(401)
@@ -24,3 +33,64 @@ func authToken(c *gin.Context) {
 	userJSON, _ := json.Marshal(user)
 	c.Request.Header.Set(TokenHeader, string(userJSON))
 }
+
+// currentUser returns the user decoded
+// by authToken from the token header, the
+// user without email is not identified as
+// it would own the events of no creator
+func currentUser(c *gin.Context) (*auth.User, error) {
+	user := &auth.User{}
+	if err := json.Unmarshal([]byte(c.Request.Header.Get(TokenHeader)), user); err != nil {
+		return nil, errors.New("auth: user not decoded")
+	}
+	if len(user.Email) == 0 {
+		return nil, errors.New("auth: user without email")
+	}
+	return user, nil
+}
+
+// ownedEvent returns the event of token if it
+// was created by the authenticated user,
+// otherwise the error response is written
+// and nil is returned
+func ownedEvent(c *gin.Context, eventToken string) *Event {
+	user, err := currentUser(c)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusUnauthorized, "User not identified")
+		return nil
+	}
+	event, err := mongo.EventByToken(eventToken)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusNotFound, "Event not exist")
+		return nil
+	}
+	if event.CreatedBy != user.Email {
+		log.Errorf("ownedEvent: %s is not the organizer of %s", user.Email, eventToken)
+		c.JSON(http.StatusForbidden, "Event not owned")
+		return nil
+	}
+	return event
+}
+
+// ownedQuestion returns the question of
+// the event created by the authenticated
+// user, otherwise the error response is
+// written and nil is returned
+func ownedQuestion(c *gin.Context, questionID string) *Question {
+	if !bson.IsObjectIdHex(questionID) {
+		c.JSON(http.StatusNotFound, "Question not exist")
+		return nil
+	}
+	q, err := mongo.QuestionById(questionID)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusNotFound, "Question not exist")
+		return nil
+	}
+	if ownedEvent(c, q.EventToken) == nil {
+		return nil
+	}
+	return q
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/suricatatalk/gate/auth"
+)
+
+// organizer sets the user decoded by
+// authToken to the user of email
+func organizer(email string) gin.HandlerFunc {
+	user, _ := json.Marshal(&auth.User{Email: email})
+	return func(c *gin.Context) {
+		c.Request.Header.Set(TokenHeader, string(user))
+	}
+}
+
+func TestModerationOwner(t *testing.T) {
+	storage := setupMemoryBackend()
+	event := &Event{Name: "Open Zlin", Moderated: true, CreatedBy: "ann@example.com", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	question := &Question{EventToken: event.EventToken, SessionToken: event.Sessions[0].SessionToken, Question: "Is it on topic?"}
+	if err := createQuestion(question); err != nil {
+		t.Fatal(err)
+	}
+
+	for email, code := range map[string]int{"ann@example.com": http.StatusOK, "bob@example.com": http.StatusForbidden, "": http.StatusUnauthorized} {
+		router := gin.New()
+		router.GET("/moderation/:eventtoken", organizer(email), getPendingQuestions)
+		router.GET("/moderation/:eventtoken/feed", organizer(email), moderationWebsockHandler)
+		router.PUT("/question/:questionID/moderate", organizer(email), moderateQuestion)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/moderation/"+event.EventToken, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Errorf("Pending questions served to %q with %d", email, w.Code)
+		}
+		if code != http.StatusOK {
+			w = httptest.NewRecorder()
+			req, _ = http.NewRequest("GET", "/moderation/"+event.EventToken+"/feed", nil)
+			router.ServeHTTP(w, req)
+			if w.Code != code {
+				t.Errorf("Moderator feed served to %q with %d", email, w.Code)
+			}
+			body, _ := json.Marshal(&ModerationDecision{Moderation: ModerationRejected})
+			w = httptest.NewRecorder()
+			req, _ = http.NewRequest("PUT", "/question/"+question.ID.Hex()+"/moderate", bytes.NewReader(body))
+			router.ServeHTTP(w, req)
+			if w.Code != code {
+				t.Errorf("Question moderated by %q with %d", email, w.Code)
+			}
+		}
+	}
+	if q, _ := storage.QuestionById(question.ID.Hex()); q.Moderation != ModerationPending {
+		t.Errorf("Question moderated by other user %s", q.Moderation)
+	}
+}
+
+func TestOrganizerRoutes(t *testing.T) {
+	storage := setupMemoryBackend()
+	event := &Event{Name: "Open Zlin", CreatedBy: "ann@example.com", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	question := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "Is it on topic?"}
+	if err := createQuestion(question); err != nil {
+		t.Fatal(err)
+	}
+	poll := &Poll{EventToken: event.EventToken, SessionToken: sessionToken, Question: "Tabs?", Options: []PollOption{{Text: "yes"}, {Text: "no"}}}
+	if err := createPoll(poll); err != nil {
+		t.Fatal(err)
+	}
+	prompt := &Prompt{EventToken: event.EventToken, SessionToken: sessionToken, Question: "Go in one word?"}
+	if err := createPrompt(prompt); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := []struct {
+		method  string
+		pattern string
+		handler gin.HandlerFunc
+		path    string
+		body    interface{}
+	}{
+		{"PUT", "/question/:questionID/state", putQuestionState, "/question/" + question.ID.Hex() + "/state", &StateChange{StateAnswered}},
+		{"DELETE", "/question/:questionID", deleteQuestion, "/question/" + question.ID.Hex(), nil},
+		{"POST", "/question/:questionID/merge", mergeQuestions, "/question/" + question.ID.Hex() + "/merge", &MergeRequest{[]string{question.ID.Hex()}}},
+		{"POST", "/poll", postPoll, "/poll", poll},
+		{"PUT", "/poll/:pollID/state", putPollState, "/poll/" + poll.ID.Hex() + "/state", &PollChange{PollOpen}},
+		{"GET", "/ballots/:pollID", getBallots, "/ballots/" + poll.ID.Hex(), nil},
+		{"POST", "/prompt", postPrompt, "/prompt", prompt},
+		{"PUT", "/prompt/:promptID/state", putPromptState, "/prompt/" + prompt.ID.Hex() + "/state", &PollChange{PollOpen}},
+		{"GET", "/responses/:promptID", getResponses, "/responses/" + prompt.ID.Hex(), nil},
+		{"GET", "/ratings/:eventtoken", getEventRatings, "/ratings/" + event.EventToken, nil},
+		{"GET", "/ratings/:eventtoken/:session", getSessionRatings, "/ratings/" + event.EventToken + "/" + sessionToken, nil},
+		{"GET", "/report/:eventtoken", getEventReport, "/report/" + event.EventToken, nil},
+		{"GET", "/report/:eventtoken/:session", getSessionReport, "/report/" + event.EventToken + "/" + sessionToken, nil},
+		{"GET", "/export/:eventtoken", getEventExport, "/export/" + event.EventToken, nil},
+		{"GET", "/export/:eventtoken/:session", getSessionExport, "/export/" + event.EventToken + "/" + sessionToken, nil},
+	}
+	for _, r := range routes {
+		router := gin.New()
+		switch r.method {
+		case "GET":
+			router.GET(r.pattern, organizer("bob@example.com"), r.handler)
+		case "POST":
+			router.POST(r.pattern, organizer("bob@example.com"), r.handler)
+		case "PUT":
+			router.PUT(r.pattern, organizer("bob@example.com"), r.handler)
+		case "DELETE":
+			router.DELETE(r.pattern, organizer("bob@example.com"), r.handler)
+		}
+		body, _ := json.Marshal(r.body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(r.method, r.path, bytes.NewReader(body))
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s served to other user with %d", r.method, r.pattern, w.Code)
+		}
+	}
+	if q, _ := storage.QuestionById(question.ID.Hex()); q == nil || q.QuestionState() != StateOpen {
+		t.Errorf("Question changed by other user %v", q)
+	}
+	if p, _ := storage.PollById(poll.ID.Hex()); p.State != PollClosed {
+		t.Errorf("Poll changed by other user %v", p)
+	}
+	if p, _ := storage.PromptById(prompt.ID.Hex()); p.State != PollClosed {
+		t.Errorf("Prompt changed by other user %v", p)
+	}
+}
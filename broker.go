@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Broker distributes the change
+// messages between all instances
+// of the service
+type Broker interface {
+	Publish(msg *Message) error
+	// Subscribe registers the handler called
+	// for each message published by any instance
+	Subscribe(handler func(msg *Message))
+	Close() error
+}
+
+// BrokerNotifier is Notifier delivering the
+// messages to connections of local manager
+// and publishing them through Broker to the
+// other instances. The messages published by
+// the notifier itself are skipped, so the
+// local connections get them even when
+// the broker fails.
+type BrokerNotifier struct {
+	broker Broker
+	local  Notifier
+	origin string
+}
+
+func NewBrokerNotifier(broker Broker, local Notifier) *BrokerNotifier {
+	n := &BrokerNotifier{broker, local, generateToken(8)}
+	broker.Subscribe(func(msg *Message) {
+		if msg.Origin == n.origin {
+			return
+		}
+		msg.Origin = ""
+		if errSlice := local.Broadcast(msg); len(errSlice) > 0 {
+			log.Errorf("BrokerNotifier: cannot deliver message %v", errSlice)
+		}
+	})
+	return n
+}
+
+func (n *BrokerNotifier) Broadcast(msg *Message) []error {
+	published := *msg
+	published.Origin = n.origin
+	errSlice := n.local.Broadcast(msg)
+	if err := n.broker.Publish(&published); err != nil {
+		errSlice = append(errSlice, err)
+	}
+	return errSlice
+}
+
+// LocalBroker is Broker for the
+// service running as single instance
+type LocalBroker struct {
+	*sync.RWMutex
+	handlers []func(msg *Message)
+}
+
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{RWMutex: &sync.RWMutex{}}
+}
+
+func (b *LocalBroker) Publish(msg *Message) error {
+	b.RLock()
+	defer b.RUnlock()
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (b *LocalBroker) Subscribe(handler func(msg *Message)) {
+	b.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.Unlock()
+}
+
+func (b *LocalBroker) Close() error {
+	return nil
+}
+
+var ErrBrokerClosed = errors.New("broker: closed")
+
+// minSubscribeBackoff is the wait before
+// reopening the failed subscription
+const minSubscribeBackoff = 100 * time.Millisecond
+
+// RedisBroker is Broker distributing
+// the messages through redis pub/sub channel
+type RedisBroker struct {
+	*sync.Mutex
+	addr     string
+	channel  string
+	timeout  time.Duration
+	pool     *redisPool
+	subConn  *redisConn
+	handlers []func(msg *Message)
+	started  bool
+	closed   chan struct{}
+}
+
+func NewRedisBroker(addr, channel string) *RedisBroker {
+	return &RedisBroker{
+		Mutex:   &sync.Mutex{},
+		addr:    addr,
+		channel: channel,
+		timeout: 5 * time.Second,
+		pool:    newRedisPool(addr, 8, 5*time.Second),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (b *RedisBroker) Publish(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-b.closed:
+		return ErrBrokerClosed
+	default:
+	}
+	_, err = b.pool.Do("PUBLISH", b.channel, string(data))
+	return err
+}
+
+// Subscribe registers the handler, the
+// subscription connection is opened with
+// the first handler and reopened whenever
+// it fails until the broker is closed.
+func (b *RedisBroker) Subscribe(handler func(msg *Message)) {
+	b.Lock()
+	b.handlers = append(b.handlers, handler)
+	start := !b.started
+	b.started = true
+	b.Unlock()
+	if start {
+		go b.subscribeLoop()
+	}
+}
+
+func (b *RedisBroker) Close() error {
+	b.Lock()
+	defer b.Unlock()
+	select {
+	case <-b.closed:
+		return nil
+	default:
+	}
+	close(b.closed)
+	b.pool.Close()
+	if b.subConn != nil {
+		b.subConn.Close()
+	}
+	return nil
+}
+
+// subscribeLoop reopens the failed subscription,
+// the backoff doubles with each failure and is
+// reset once the subscription is acknowledged
+func (b *RedisBroker) subscribeLoop() {
+	backoff := minSubscribeBackoff
+	for {
+		err := b.subscribe(func() { backoff = minSubscribeBackoff })
+		select {
+		case <-b.closed:
+			return
+		case <-time.After(backoff):
+		}
+		log.Errorf("RedisBroker: subscription failed %v", err)
+		if backoff < 10*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// subscribe reads the messages of
+// subscribed channel until the
+// connection fails, subscribed is
+// called with the acknowledgement
+func (b *RedisBroker) subscribe(subscribed func()) error {
+	conn, err := dialRedis(b.addr, b.timeout)
+	if err != nil {
+		return err
+	}
+	b.Lock()
+	select {
+	case <-b.closed:
+		b.Unlock()
+		return conn.Close()
+	default:
+	}
+	b.subConn = conn
+	b.Unlock()
+	defer conn.Close()
+
+	if err := conn.Send("SUBSCRIBE", b.channel); err != nil {
+		return err
+	}
+	for {
+		reply, err := conn.Receive()
+		if err != nil {
+			return err
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 {
+			continue
+		}
+		if items[0] == "subscribe" {
+			subscribed()
+			continue
+		}
+		if items[0] != "message" {
+			continue
+		}
+		payload, _ := items[2].(string)
+		b.dispatch([]byte(payload))
+	}
+}
+
+func (b *RedisBroker) dispatch(payload []byte) {
+	received := struct {
+		Message
+		Data json.RawMessage `json:"data,omitempty"`
+	}{}
+	if err := json.Unmarshal(payload, &received); err != nil {
+		log.Errorf("RedisBroker: malformed message %v", err)
+		return
+	}
+	msg := received.Message
+	if len(received.Data) > 0 {
+		msg.Data = received.Data
+	}
+	b.Lock()
+	handlers := append([]func(msg *Message){}, b.handlers...)
+	b.Unlock()
+	for _, handler := range handlers {
+		m := msg
+		handler(&m)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is local stand-in of redis
+// server supporting PUBLISH and SUBSCRIBE
+type fakeRedis struct {
+	*sync.Mutex
+	listener    net.Listener
+	subscribers map[string][]net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedis{
+		Mutex:       &sync.Mutex{},
+		listener:    listener,
+		subscribers: make(map[string][]net.Conn),
+	}
+	go server.serve()
+	return server
+}
+
+func (s *fakeRedis) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedis) Close() {
+	s.listener.Close()
+}
+
+func (s *fakeRedis) Subscribers(channel string) int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.subscribers[channel])
+}
+
+// DropSubscribers closes the
+// connections of subscribers
+func (s *fakeRedis) DropSubscribers() {
+	s.Lock()
+	defer s.Unlock()
+	for channel, conns := range s.subscribers {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		delete(s.subscribers, channel)
+	}
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readRedisReply(r)
+		if err != nil {
+			return
+		}
+		args := make([]string, 0)
+		for _, item := range reply.([]interface{}) {
+			args = append(args, item.(string))
+		}
+		s.Lock()
+		switch args[0] {
+		case "SUBSCRIBE":
+			s.subscribers[args[1]] = append(s.subscribers[args[1]], conn)
+			conn.Write([]byte("*3\r\n$9\r\nsubscribe\r\n$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n:1\r\n"))
+		case "PUBLISH":
+			for _, sub := range s.subscribers[args[1]] {
+				writeRedisCommand(sub, "message", args[1], args[2])
+			}
+			conn.Write([]byte(":1\r\n"))
+		default:
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+		s.Unlock()
+	}
+}
+
+func TestLocalBrokerNotifier(t *testing.T) {
+	manager := newMapEventManager(*wsCfg)
+	client := addIdleClient(manager, "abcd", "1234")
+	notifier := NewBrokerNotifier(NewLocalBroker(), manager)
+
+	notifier.Broadcast(&Message{Type: MsgQuestionAdded, EventToken: "abcd", SessionToken: "1234"})
+
+	if len(client.queue) != 1 || manager.Seq("abcd", "1234") != 1 {
+		t.Error("Message not delivered to local manager")
+	}
+}
+
+func TestRedisBrokerFanOut(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.Close()
+
+	// Two service instances with
+	// their own connection managers
+	managerA := newMapEventManager(*wsCfg)
+	managerB := newMapEventManager(*wsCfg)
+	clientA := addIdleClient(managerA, "abcd", "1234")
+	clientB := addIdleClient(managerB, "abcd", "1234")
+	brokerA := NewRedisBroker(server.Addr(), "surikata")
+	brokerB := NewRedisBroker(server.Addr(), "surikata")
+	defer brokerA.Close()
+	defer brokerB.Close()
+	notifierA := NewBrokerNotifier(brokerA, managerA)
+	NewBrokerNotifier(brokerB, managerB)
+
+	if !waitFor(func() bool { return server.Subscribers("surikata") == 2 }) {
+		t.Fatal("Brokers not subscribed")
+	}
+
+	errSlice := notifierA.Broadcast(&Message{
+		Type:         MsgQuestionVoted,
+		EventToken:   "abcd",
+		SessionToken: "1234",
+		Data:         &QuestionRef{Vote: 3},
+	})
+	if len(errSlice) > 0 {
+		t.Fatal(errSlice)
+	}
+
+	for name, client := range map[string]*Subscription{"A": clientA, "B": clientB} {
+		if !waitFor(func() bool { return len(client.queue) == 1 }) {
+			t.Errorf("Message not delivered to instance %s", name)
+			continue
+		}
+		received := &Message{}
+		json.Unmarshal(<-client.queue, received)
+		data, _ := received.Data.(map[string]interface{})
+		if received.Type != MsgQuestionVoted || received.Seq != 1 || data["vote"] != float64(3) {
+			t.Errorf("Unexpected message %v on instance %s", received, name)
+		}
+	}
+}
+
+func TestRedisBrokerResubscribe(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.Close()
+	broker := NewRedisBroker(server.Addr(), "surikata")
+	defer broker.Close()
+	NewBrokerNotifier(broker, newMapEventManager(*wsCfg))
+
+	// The backoff growing over the drops
+	// would wait more than three seconds
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if !waitFor(func() bool { return server.Subscribers("surikata") == 1 }) {
+			t.Fatalf("Broker not subscribed after %d drops", i)
+		}
+		server.DropSubscribers()
+	}
+	if !waitFor(func() bool { return server.Subscribers("surikata") == 1 }) {
+		t.Fatal("Broker not subscribed after drops")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Backoff not reset after subscription %v", elapsed)
+	}
+}
+
+func TestRedisBrokerDownDeliversLocally(t *testing.T) {
+	manager := newMapEventManager(*wsCfg)
+	client := addIdleClient(manager, "abcd", "1234")
+	broker := NewRedisBroker("127.0.0.1:1", "surikata")
+	defer broker.Close()
+	notifier := NewBrokerNotifier(broker, manager)
+
+	errSlice := notifier.Broadcast(&Message{Type: MsgQuestionAdded, EventToken: "abcd", SessionToken: "1234"})
+	if len(errSlice) != 1 {
+		t.Errorf("Publish error not reported %v", errSlice)
+	}
+	if len(client.queue) != 1 || manager.Seq("abcd", "1234") != 1 {
+		t.Error("Message not delivered to local manager")
+	}
+}
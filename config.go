@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/kelseyhightower/envconfig"
@@ -12,6 +14,72 @@ type AppConfig struct {
 	Host string `default:"127.0.0.1"`
 	Port string `default:"7070"`
 	Name string `default:"core1"`
+	// Storage selects the DataStorage
+	// implementation, "mongo" or "memory"
+	Storage string `default:"mongo"`
+}
+
+// QuestionConfig holds the
+// question handling settings
+type QuestionConfig struct {
+	// EditGracePeriod is the time after
+	// posting the author can edit question
+	EditGracePeriod time.Duration `default:"5m"`
+	// TrendingHalfLife is the age at which
+	// vote counts half in trending sort
+	TrendingHalfLife time.Duration `default:"10m"`
+	// PageSize is the default and MaxPageSize
+	// the largest page of question listing
+	PageSize    int `default:"50"`
+	MaxPageSize int `default:"200"`
+	// DuplicateThreshold is the smallest
+	// similarity of duplicate question
+	DuplicateThreshold float64 `default:"0.5"`
+	// SnapshotLimit is the largest
+	// number of questions in snapshot
+	SnapshotLimit int `default:"100"`
+}
+
+// validate refuses the page sizes
+// that cannot hold any question
+func (q *QuestionConfig) validate() error {
+	if q.PageSize < 1 || q.MaxPageSize < 1 || q.SnapshotLimit < 1 {
+		return errors.New("config: question page size, max page size and snapshot limit must be at least 1")
+	}
+	return nil
+}
+
+// FilterConfig holds the settings
+// of built-in content filters
+type FilterConfig struct {
+	// WordList is the file with lines of
+	// language and word added to built-in list
+	WordList       string
+	MaxLinks       int     `default:"1"`
+	MaxRepeat      int     `default:"4"`
+	CapsRatio      float64 `default:"0.7"`
+	CapsMinLetters int     `default:"12"`
+	// Policy is the content policy
+	// of events without own policy
+	Policy string `default:"reject"`
+}
+
+// RateConfig holds the rate limits of
+// routes in form of "burst/period"
+type RateConfig struct {
+	// Store selects the bucket store,
+	// "memory" or "redis" shared by instances
+	Store     string `default:"memory"`
+	RedisAddr string `default:"127.0.0.1:6379"`
+	Question  string `default:"5/1m"`
+	Vote      string `default:"60/1m"`
+	// IPFactor multiplies the limits
+	// of the client address
+	IPFactor int `default:"20"`
+	// TrustedProxies are the comma separated
+	// addresses or networks of proxies, their
+	// forwarded header hops are trusted
+	TrustedProxies string `default:""`
 }
 
 type MgoConfig struct {
@@ -23,8 +91,51 @@ type EtcdConfig struct {
 	Endpoint string `default:"http://127.0.0.1:4001"`
 }
 
+// WsConfig holds the settings of
+// live connections, the websockets,
+// event streams and long polls
+type WsConfig struct {
+	// PongWait is the time allowed
+	// to read next pong from peer
+	PongWait time.Duration `default:"60s"`
+	// PingPeriod is the period of pings
+	// sent to peer, must be less than PongWait
+	PingPeriod time.Duration `default:"54s"`
+	// WriteWait is the time allowed
+	// to write a message to peer
+	WriteWait      time.Duration `default:"10s"`
+	MaxMessageSize int64         `default:"4096"`
+	// QueueSize is the number of messages
+	// queued for each connection
+	QueueSize int `default:"16"`
+	// SlowConsumer is the policy applied when
+	// the queue of connection is full, one of
+	// drop_oldest, coalesce or disconnect
+	SlowConsumer SlowConsumerPolicy `default:"drop_oldest"`
+	// PollTimeout is the time long poll
+	// request waits for new messages
+	PollTimeout time.Duration `default:"25s"`
+	// ReplaySize is the number of messages
+	// buffered per session for resume
+	ReplaySize int `default:"256"`
+	// PresenceInterval is the minimal period
+	// of audience updates sent to sessions
+	PresenceInterval time.Duration `default:"5s"`
+}
+
+// BrokerConfig selects the Broker
+// distributing messages between
+// service instances
+type BrokerConfig struct {
+	// Type is "local" for single instance
+	// or "redis" for multiple instances
+	Type      string `default:"local"`
+	RedisAddr string `default:"127.0.0.1:6379"`
+	Channel   string `default:"surikata"`
+}
+
 // loadConfiguration loads the configuration of application
-func loadConfiguration(app *AppConfig, mgo *MgoConfig, etcd *EtcdConfig) {
+func loadConfiguration(app *AppConfig, mgo *MgoConfig, etcd *EtcdConfig, ws *WsConfig, broker *BrokerConfig, question *QuestionConfig, filter *FilterConfig, rate *RateConfig) {
 	err := envconfig.Process("core", app)
 	if err != nil {
 		log.Panicln(err)
@@ -37,6 +148,29 @@ func loadConfiguration(app *AppConfig, mgo *MgoConfig, etcd *EtcdConfig) {
 	if err != nil {
 		log.Panicln(err)
 	}
+	err = envconfig.Process("ws", ws)
+	if err != nil {
+		log.Panicln(err)
+	}
+	err = envconfig.Process("broker", broker)
+	if err != nil {
+		log.Panicln(err)
+	}
+	err = envconfig.Process("question", question)
+	if err == nil {
+		err = question.validate()
+	}
+	if err != nil {
+		log.Panicln(err)
+	}
+	err = envconfig.Process("filter", filter)
+	if err != nil {
+		log.Panicln(err)
+	}
+	err = envconfig.Process("rate", rate)
+	if err != nil {
+		log.Panicln(err)
+	}
 	if len(os.Getenv(KeyLogly)) > 0 {
 		hook := logrusly.NewLogglyHook(os.Getenv(KeyLogly),
 			app.Host,
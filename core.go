@@ -2,8 +2,11 @@ package main
 
 import (
 	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -11,6 +14,8 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/itsjamie/gin-cors"
 	"github.com/sohlich/etcd_discovery"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 const (
@@ -24,6 +29,14 @@ const (
 
 	// TokenHeader is header with auth informations
 	TokenHeader = "X-AUTH"
+
+	// ClientHeader is header with
+	// identification of attendee client
+	ClientHeader = "X-CLIENT"
+
+	// AuthorHeader is header with the
+	// author secret of question
+	AuthorHeader = "X-AUTHOR"
 )
 
 var (
@@ -35,6 +48,34 @@ var (
 		ServiceName: ServiceName,
 	}
 	registryClient *discovery.EtcdReigistryClient
+	wsCfg          = &WsConfig{
+		PongWait:         60 * time.Second,
+		PingPeriod:       54 * time.Second,
+		WriteWait:        10 * time.Second,
+		MaxMessageSize:   4096,
+		QueueSize:        16,
+		SlowConsumer:     PolicyDropOldest,
+		PollTimeout:      25 * time.Second,
+		ReplaySize:       256,
+		PresenceInterval: 5 * time.Second,
+	}
+	questionCfg = &QuestionConfig{
+		EditGracePeriod:    5 * time.Minute,
+		TrendingHalfLife:   10 * time.Minute,
+		PageSize:           50,
+		MaxPageSize:        200,
+		SnapshotLimit:      100,
+		DuplicateThreshold: 0.5,
+	}
+	filterCfg = &FilterConfig{
+		MaxLinks:       1,
+		MaxRepeat:      4,
+		CapsRatio:      0.7,
+		CapsMinLetters: 12,
+		Policy:         ContentReject,
+	}
+	contentFilter ContentFilter = NewFilterPipeline(filterCfg, defaultWords)
+	limiter       *Limiter
 )
 
 var wsupgrader = websocket.Upgrader{
@@ -49,7 +90,25 @@ func main() {
 	appCfg := &AppConfig{}
 	mgoCfg := &MgoConfig{}
 	etcdCfg := &EtcdConfig{}
-	loadConfiguration(appCfg, mgoCfg, etcdCfg)
+	brokerCfg := &BrokerConfig{}
+	rateCfg := &RateConfig{}
+	loadConfiguration(appCfg, mgoCfg, etcdCfg, wsCfg, brokerCfg, questionCfg, filterCfg, rateCfg)
+
+	words, wordsErr := LoadWordList(filterCfg.WordList)
+	if wordsErr != nil {
+		log.Panicln(wordsErr)
+	}
+	contentFilter = NewFilterPipeline(filterCfg, words)
+
+	var limitStore LimitStore = NewMemoryLimitStore()
+	if rateCfg.Store == "redis" {
+		log.Infof("Initializing redis rate limit store %s", rateCfg.RedisAddr)
+		limitStore = NewRedisLimitStore(rateCfg.RedisAddr, "ratelimit")
+	}
+	var limiterErr error
+	if limiter, limiterErr = NewLimiter(limitStore, rateCfg); limiterErr != nil {
+		log.Panicln(limiterErr)
+	}
 
 	var registryErr error
 	log.Infof("Initializing service discovery client for %s", appCfg.Name)
@@ -62,27 +121,61 @@ func main() {
 	}
 	registryClient.Register()
 
-	log.Infoln("Initializing mongo storage with credentials %s , %s", mgoCfg.URI, mgoCfg.DB)
-	localMgo := NewMgoStorage()
-	localMgo.connectionString = mgoCfg.URI
-	localMgo.database = mgoCfg.DB
-	mongo = localMgo
+	switch appCfg.Storage {
+	case "memory":
+		log.Infoln("Initializing in-memory storage")
+		mongo = NewMemoryStorage()
+	default:
+		log.Infoln("Initializing mongo storage with credentials %s , %s", mgoCfg.URI, mgoCfg.DB)
+		localMgo := NewMgoStorage()
+		localMgo.connectionString = mgoCfg.URI
+		localMgo.database = mgoCfg.DB
+		mongo = localMgo
+	}
 
-	eventConnManager := NewEventManager()
+	var broker Broker
+	switch brokerCfg.Type {
+	case "redis":
+		log.Infof("Initializing redis broker %s", brokerCfg.RedisAddr)
+		broker = NewRedisBroker(brokerCfg.RedisAddr, brokerCfg.Channel)
+	default:
+		broker = NewLocalBroker()
+	}
+	defer broker.Close()
+
+	eventConnManager := NewEventManager(wsCfg)
 	commMan = eventConnManager
-	notifier = eventConnManager
+	notifier = NewBrokerNotifier(broker, eventConnManager)
+	expvar.Publish("eventmanager", expvar.Func(func() interface{} {
+		return eventConnManager.Stats()
+	}))
+	go presencePump(eventConnManager, wsCfg.PresenceInterval, nil)
+	go peakPump(eventConnManager, wsCfg.PresenceInterval, nil)
+	go feedbackPump(eventConnManager, eventConnManager, wsCfg.PresenceInterval, nil)
 	err := mongo.OpenSession()
 	if err != nil {
 		log.Panicln(err)
 	}
 
-	r := gin.Default()
+	r := setupRouter()
+	bind := fmt.Sprintf(":%s", appCfg.Port)
+	r.Run(bind)
+}
+
+// setupRouter creates the gin engine
+// with all middlewares and routes
+func setupRouter() *gin.Engine {
+	// The gin logger would log the
+	// token query parameter, so only
+	// the redacting logger is used
+	r := gin.New()
+	r.Use(gin.Recovery())
 	log.Infoln("Configuring CORS Middleware")
 	r.Use(logrusLogger())
 	r.Use(cors.Middleware(cors.Config{
 		Origins:         "*",
 		Methods:         "GET, PUT, POST, DELETE",
-		RequestHeaders:  "Origin, Authorization, Content-Type, X-AUTH",
+		RequestHeaders:  "Origin, Authorization, Content-Type, X-AUTH, X-CLIENT, X-AUTHOR",
 		ExposedHeaders:  "",
 		MaxAge:          50 * time.Second,
 		Credentials:     true,
@@ -90,75 +183,167 @@ func main() {
 	}))
 
 	//Public
-	r.POST("/question/:questionID", voteQuestion)
-	r.DELETE("/question/:questionID", voteQuestion)
-	r.POST("/question", postQuestion)
-	r.GET("/event/:eventtoken/:session", eventWebsockHandler)
+	r.POST("/question/:questionID", rateLimit(RouteVote, votedEvent), voteQuestion)
+	r.DELETE("/question/:questionID/vote", rateLimit(RouteVote, votedEvent), voteQuestion)
+	r.PUT("/question/:questionID", editQuestion)
+	r.DELETE("/question/:questionID", authorOrToken, deleteQuestion)
+	r.GET("/author/:eventtoken", getAuthorQuestions)
+	r.POST("/question", rateLimit(RouteQuestion, postedEvent), postQuestion)
+	r.GET("/event/:eventtoken/:session", publicSession, eventWebsockHandler)
 	r.GET("/event/:eventtoken", getEvent)
+	r.GET("/sse/:eventtoken/:session", publicSession, eventStreamHandler)
+	r.GET("/poll/:eventtoken/:session", publicSession, eventPollHandler)
+	r.GET("/questions/:eventtoken/:session", getQuestions)
+	r.GET("/polls/:eventtoken/:session", getPolls)
+	r.POST("/poll/:pollID/vote", rateLimit(RouteVote, polledEvent), votePoll)
+	r.GET("/prompts/:eventtoken/:session", getPrompts)
+	r.POST("/prompt/:promptID/response", rateLimit(RouteVote, promptedEvent), respondPrompt)
+	r.POST("/rating/:eventtoken/:session", rateLimit(RouteQuestion, ratedEvent), postRating)
+	r.GET("/presence/:eventtoken", getPresence)
 	r.GET("/speaker/:speakerID", getSpeaker)
 	//Admin
 	authReqi := r.Group("/")
 	authReqi.Use(authToken)
 	authReqi.POST("/event", upsertEvent(insertEvent))
 	authReqi.PUT("/event", upsertEvent(updateEvent))
+	authReqi.GET("/events", getEvents)
 	authReqi.POST("/speaker", upsertSpeaker(insertSpeaker))
 	authReqi.PUT("/speaker", upsertSpeaker(updateSpeaker))
-
-	bind := fmt.Sprintf(":%s", appCfg.Port)
-	r.Run(bind)
+	authReqi.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	authReqi.GET("/admin/busiest", getBusiestSessions)
+	authReqi.GET("/moderation/:eventtoken", getPendingQuestions)
+	authReqi.GET("/moderation/:eventtoken/feed", moderationWebsockHandler)
+	authReqi.PUT("/question/:questionID/moderate", moderateQuestion)
+	authReqi.PUT("/question/:questionID/state", putQuestionState)
+	authReqi.POST("/question/:questionID/merge", mergeQuestions)
+	authReqi.POST("/poll", postPoll)
+	authReqi.PUT("/poll/:pollID/state", putPollState)
+	authReqi.GET("/ballots/:pollID", getBallots)
+	authReqi.POST("/prompt", postPrompt)
+	authReqi.PUT("/prompt/:promptID/state", putPromptState)
+	authReqi.GET("/responses/:promptID", getResponses)
+	authReqi.GET("/ratings/:eventtoken", getEventRatings)
+	authReqi.GET("/ratings/:eventtoken/:session", getSessionRatings)
+	authReqi.GET("/report/:eventtoken", getEventReport)
+	authReqi.GET("/report/:eventtoken/:session", getSessionReport)
+	authReqi.GET("/export/:eventtoken", getEventExport)
+	authReqi.GET("/export/:eventtoken/:session", getSessionExport)
+	return r
 }
 
 func logrusLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		log.Infof("%s:%s from %s", c.Request.Method, c.Request.URL.String(), c.Request.Header.Get("X-Forwarded-For"))
+		log.Infof("%s:%s from %s", c.Request.Method, redactedURL(c.Request.URL), c.Request.Header.Get("X-Forwarded-For"))
 	}
 }
 
+// redactedURL returns the url with the
+// values of secret query parameters
+// replaced, so they are not logged
+func redactedURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for _, param := range []string{"token", "secret"} {
+		if _, ok := query[param]; ok {
+			query.Set(param, "REDACTED")
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
 func eventWebsockHandler(c *gin.Context) {
 	log.Printf("Receiving WS request %s", c.Request.Header)
-	eventToken := c.Params.ByName("eventtoken")
-	sessitonToken := c.Params.ByName("session")
+	serveSocket(c, c.Params.ByName("eventtoken"), c.Params.ByName("session"))
+}
 
+// serveSocket upgrades the connection and
+// subscribes it to the event session feed
+func serveSocket(c *gin.Context, eventToken, sessionToken string) {
 	conn, err := wsupgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Errorf("Failed to set websocket upgrade: %v", err)
 		return
 	}
 
-	updateErr := notifyChangeForConnection(conn, eventToken, sessitonToken)
+	sub, updateErr := subscribeClient(c, eventToken, sessionToken)
 	if updateErr != nil {
 		log.Errorln(updateErr)
 	}
-	commMan.RegisterConnection(eventToken, sessitonToken, conn)
+	sub.Client = clientID(c)
+	sub.Addr = clientAddr(c)
+	commMan.AttachConnection(sub, conn)
+
+	readPump(sub, conn, *wsCfg)
+}
+
+// clientID returns the identification of attendee
+// client, the query parameter is accepted for
+// websockets which cannot set the headers.
+func clientID(c *gin.Context) string {
+	client := c.Request.Header.Get(ClientHeader)
+	if len(client) == 0 {
+		client = c.Query("client")
+	}
+	return client
 }
 
 func voteQuestion(c *gin.Context) {
 	questionID := c.Params.ByName("questionID")
+	client := clientID(c)
+	if len(client) == 0 {
+		log.Errorln("voteQuestion: client header not found")
+		c.JSON(http.StatusBadRequest, "Client not identified")
+		return
+	}
 
-	log.Infof("voteQuestion: voting question %s", questionID)
+	log.Infof("voteQuestion: client %s voting question %s", client, questionID)
 
-	incBy := 1
+	operation := OperationUpvote
 	if c.Request.Method == "DELETE" {
-		incBy = -1
+		operation = OperationRetract
 	}
-	err := mongo.VoteQuestion(questionID, incBy)
+	q, err := castVote(questionID, client, operation)
 
-	if err != nil {
+	if err == ErrAlreadyVoted || err == ErrNotVoted {
 		log.Errorln(err)
-		c.JSON(405, "Event not exist")
+		c.JSON(http.StatusConflict, err.Error())
 		return
 	}
-	q, qerr := mongo.QuestionById(questionID)
-	if qerr != nil {
-		log.Errorln(qerr)
+	if err != nil {
+		log.Errorln(err)
 		c.JSON(405, "Event not exist")
 		return
 	}
-	updateErr := notifyChange(q.EventToken, q.SessionToken)
+	c.JSON(200, q)
+}
+
+// castVote applies the vote operation of client
+// and notifies the session subscribers
+func castVote(questionID, client string, operation int) (*Question, error) {
+	if !bson.IsObjectIdHex(questionID) {
+		return nil, mgo.ErrNotFound
+	}
+	// The questions not visible to the
+	// audience cannot be voted
+	q, err := mongo.QuestionById(questionID)
+	if err != nil {
+		return nil, err
+	}
+	if !q.Visible() {
+		return nil, mgo.ErrNotFound
+	}
+	if err := mongo.VoteQuestion(questionID, client, operation); err != nil {
+		return nil, err
+	}
+	if q, err = mongo.QuestionById(questionID); err != nil {
+		return nil, err
+	}
+	updateErr := notifyChange(q.EventToken, q.SessionToken, MsgQuestionVoted, &QuestionRef{q.ID, q.Vote})
 	if updateErr != nil {
 		log.Errorln(updateErr)
 	}
-	c.JSON(200, q)
+	return q, nil
 }
 
 func postQuestion(c *gin.Context) {
@@ -172,42 +357,184 @@ func postQuestion(c *gin.Context) {
 
 	log.Infof("postQuestion: posting question %s", question)
 
-	_, err = mongo.EventByToken(question.EventToken)
-	if err != nil {
+	if secret := c.Request.Header.Get(AuthorHeader); len(secret) > 0 {
+		question.AuthorSecret = secret
+	}
+	question.Client = clientID(c)
+	err = createQuestion(question)
+	if err == mgo.ErrNotFound {
 		log.Errorln(err)
 		c.JSON(405, "Event not exist")
 		return
 	}
-	mongo.InsertQuestion(question)
-	updateErr := notifyChange(question.EventToken, question.SessionToken)
-	if updateErr != nil {
-		log.Errorln(updateErr)
+	if err == ErrNotAuthor {
+		log.Errorln(err)
+		c.JSON(http.StatusForbidden, err.Error())
+		return
+	}
+	if contentErr, ok := err.(*ContentError); ok {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, &ContentRejection{contentErr.Error(), contentErr.Violations})
+		return
+	}
+	if dupErr, ok := err.(*DuplicateError); ok {
+		c.JSON(http.StatusConflict, &DuplicateSuggestion{dupErr.Error(), dupErr.Duplicates})
+		return
+	}
+	if _, ok := err.(*ValidationError); ok {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot store the question")
+		return
 	}
 	c.JSON(200, question)
 }
 
-func notifyChange(eventToken, sessionToken string) error {
-	questions, err := mongo.QuestionsByEventAndSession(eventToken, sessionToken)
+// createQuestion validates and stores the question
+// and notifies the session subscribers. The author
+// secret of question, if set, is kept by the caller
+// and must be at least MinSecretLength long,
+// otherwise new secret is issued and returned
+// in the question. Unless
+// forced, the question similar to existing
+// question is refused with DuplicateError.
+func createQuestion(question *Question) error {
+	event, err := mongo.EventByToken(question.EventToken)
 	if err != nil {
 		return err
 	}
-	errSlice := notifier.SendJsonByEventAndSessionToken(eventToken, sessionToken, questions)
+	if err := ValidateQuestion(question, event); err != nil {
+		return err
+	}
+	question.Flags = nil
+	flagged, err := filterQuestion(question, event)
+	if err != nil {
+		return err
+	}
+	if !question.Force {
+		duplicates, err := findDuplicates(question)
+		if err != nil {
+			return err
+		}
+		if len(duplicates) > 0 {
+			return &DuplicateError{duplicates}
+		}
+	}
+	question.Force = false
+	question.Vote = 0
+	question.Voters = nil
+	question.CreateTime = time.Now().Unix()
+	secret := question.AuthorSecret
+	question.AuthorSecret = ""
+	issued := len(secret) == 0
+	if issued {
+		secret = generateToken(32)
+	} else if len(secret) < MinSecretLength {
+		// The short secret could
+		// be guessed by others
+		return ErrNotAuthor
+	}
+	question.AuthorHash = hashSecret(secret)
+	question.State = StateOpen
+	question.Moderation = ModerationApproved
+	if event.Moderated || flagged {
+		question.Moderation = ModerationPending
+	}
+	if err := mongo.InsertQuestion(question); err != nil {
+		return err
+	}
+	// Pending questions are
+	// seen by moderators only
+	sessionToken := question.SessionToken
+	if !question.Visible() {
+		sessionToken = ModerationSession
+	}
+	updateErr := notifyChange(question.EventToken, sessionToken, MsgQuestionAdded, question)
+	if updateErr != nil {
+		log.Errorln(updateErr)
+	}
+	// The secret is returned to the
+	// author only, never broadcast
+	if issued {
+		question.AuthorSecret = secret
+	}
+	return nil
+}
+
+// notifyChange broadcasts the change
+// message to the session subscribers
+func notifyChange(eventToken, sessionToken, msgType string, data interface{}) error {
+	errSlice := notifier.Broadcast(&Message{
+		Type:         msgType,
+		EventToken:   eventToken,
+		SessionToken: sessionToken,
+		Data:         data,
+	})
 	if len(errSlice) > 0 {
 		return errors.New("Err while sending update")
 	}
 	return nil
 }
 
-func notifyChangeForConnection(conn *websocket.Conn, eventToken, sessionToken string) error {
-	questions, err := mongo.QuestionsByEventAndSession(eventToken, sessionToken)
+// notifyChangeForConnection sends the snapshot
+// of session questions to the subscription
+func notifyChangeForConnection(sub *Subscription) error {
+	snapshot, err := snapshotMessage(sub.EventToken, sub.SessionToken, sub.Sort)
 	if err != nil {
 		return err
 	}
-	sendErr := conn.WriteJSON(questions)
-	if sendErr != nil {
-		return sendErr
+	return commMan.Send(sub, snapshot)
+}
+
+// snapshotMessage creates the snapshot
+// message of session questions ordered
+// by the sort mode
+func snapshotMessage(eventToken, sessionToken, sortMode string) (*Message, error) {
+	// The sequence is obtained before loading
+	// so the snapshot contains at least
+	// all the changes up to the sequence
+	seq := commMan.Seq(eventToken, sessionToken)
+	var questions []Question
+	if sessionToken == ModerationSession {
+		pending, err := mongo.PendingQuestions(eventToken)
+		if err != nil {
+			return nil, err
+		}
+		questions = pending
+	} else {
+		// The large sessions are limited to the
+		// first questions of the sort mode, the
+		// posting order keeps the most voted
+		query := &QuestionQuery{
+			EventToken:   eventToken,
+			SessionToken: sessionToken,
+			Sort:         sortMode,
+			Limit:        questionCfg.SnapshotLimit,
+		}
+		if sortMode == "" {
+			query.Sort = SortTop
+		}
+		page, err := listQuestions(query)
+		if err != nil {
+			return nil, err
+		}
+		questions = page.Questions
+		if sortMode == "" {
+			sort.Sort(byPosting(questions))
+		}
 	}
-	return nil
+	return &Message{
+		Type:         MsgSnapshot,
+		Seq:          seq,
+		Stream:       commMan.Stream(),
+		EventToken:   eventToken,
+		SessionToken: sessionToken,
+		Data:         questions,
+	}, nil
 }
 
 // Event handlers
@@ -236,6 +563,12 @@ func upsertEvent(handler eventHandlerFunc) gin.HandlerFunc {
 
 func insertEvent(c *gin.Context, event *Event) {
 	log.Infof("insertEvent : inserting event %s", event)
+	// The creator is taken from token only,
+	// never from the posted event
+	event.CreatedBy = ""
+	if user, err := currentUser(c); err == nil {
+		event.CreatedBy = user.Email
+	}
 	err := mongo.InsertEvent(event)
 	if err != nil {
 		log.Errorln(err)
@@ -247,12 +580,34 @@ func insertEvent(c *gin.Context, event *Event) {
 
 func updateEvent(c *gin.Context, event *Event) {
 	log.Infof("updateEvent : inserting event %s", event)
-	err := mongo.UpdateEvent(event)
+	user, err := currentUser(c)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusUnauthorized, "User not identified")
+		return
+	}
+	// The event is looked up by the id
+	// the update is written by
+	previous, err := mongo.EventById(event.ID.Hex())
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusNotFound, "Event not exist")
+		return
+	}
+	if previous.CreatedBy != user.Email {
+		c.JSON(http.StatusForbidden, "Event not owned")
+		return
+	}
+	// The creator is kept, so the
+	// event stays listed for it
+	event.CreatedBy = previous.CreatedBy
+	err = mongo.UpdateEvent(event)
 	if err != nil {
 		log.Errorln(err)
 		c.JSON(http.StatusInternalServerError, "Cannot update event")
 		return
 	}
+	notifyFeedbackOpen(previous, event)
 	c.JSON(http.StatusOK, event)
 }
 
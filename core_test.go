@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactedURL(t *testing.T) {
+	u, _ := url.Parse("/moderation/abcd/feed?token=eyJhbGciOi&secret=s3cret&client=c1")
+	redacted := redactedURL(u)
+	if strings.Contains(redacted, "eyJhbGciOi") || strings.Contains(redacted, "s3cret") {
+		t.Errorf("Secrets logged %s", redacted)
+	}
+	if !strings.HasPrefix(redacted, "/moderation/abcd/feed?") || !strings.Contains(redacted, "client=c1") {
+		t.Errorf("Unexpected url %s", redacted)
+	}
+	if u.RawQuery != "token=eyJhbGciOi&secret=s3cret&client=c1" {
+		t.Error("Request url changed")
+	}
+}
@@ -3,16 +3,46 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/satori/go.uuid"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
+const (
+	// OperationUpvote is the vote operation
+	// adding client vote to question
+	OperationUpvote = 1
+	// OperationRetract is the vote operation
+	// taking client vote back
+	OperationRetract = -1
+)
+
+var (
+	ErrAlreadyVoted = errors.New("storage: client already voted for question")
+	ErrNotVoted     = errors.New("storage: client has no vote to retract")
+	// ErrMergeConflict is returned when the
+	// merged questions keep changing by votes
+	ErrMergeConflict = errors.New("storage: questions changed during merge")
+)
+
+// mergeRetries is the number of attempts
+// to update the merged question unchanged
+const mergeRetries = 5
+
+// Vote is the record in vote
+// history of question
 type Vote struct {
-	Client    string
-	VoteTime  int64
-	Operation int
+	ID         bson.ObjectId `bson:"_id" json:"id"`
+	QuestionID bson.ObjectId `json:"questionId"`
+	Client     string        `json:"client"`
+	VoteTime   int64         `json:"voteTime"`
+	Operation  int           `json:"operation"`
 }
 
 type Question struct {
@@ -22,6 +52,75 @@ type Question struct {
 	Question     string        `json:"question"`
 	Vote         int           `json:"vote"`
 	CreateTime   int64         `json:"createTime"`
+	// Voters holds the clients
+	// currently voting for question
+	Voters []string `json:"-"`
+	// Moderation is the state of question
+	// in moderation queue, the empty
+	// state is considered approved
+	Moderation string `json:"moderation,omitempty"`
+	// State is the lifecycle state of
+	// question, the empty state is
+	// considered open
+	State string `json:"state,omitempty"`
+	// AuthorHash is the hash of author
+	// secret issued when question posted
+	AuthorHash string `json:"-"`
+	// AuthorSecret is returned to the
+	// author only once and never stored
+	AuthorSecret string `bson:"-" json:"authorSecret,omitempty"`
+	// Score is the trending score of
+	// question in trending listing
+	Score float64 `bson:"-" json:"score,omitempty"`
+	// Force posts the question even
+	// if similar question exists
+	Force bool `bson:"-" json:"force,omitempty"`
+	// Flags are the content filter violations
+	// of question sent to moderation
+	Flags []Violation `json:"flags,omitempty"`
+	// Client identifies the attendee
+	// client that posted the question
+	Client string `json:"-"`
+}
+
+// Lifecycle states of question
+const (
+	StateOpen     = "open"
+	StatePinned   = "pinned"
+	StateAnswered = "answered"
+	StateArchived = "archived"
+)
+
+// QuestionState returns the lifecycle
+// state of question
+func (q *Question) QuestionState() string {
+	if q.State == "" {
+		return StateOpen
+	}
+	return q.State
+}
+
+// ValidState reports whether the
+// state is known lifecycle state
+func ValidState(state string) bool {
+	switch state {
+	case StateOpen, StatePinned, StateAnswered, StateArchived:
+		return true
+	}
+	return false
+}
+
+// Moderation states of question
+const (
+	ModerationPending  = "pending"
+	ModerationApproved = "approved"
+	ModerationRejected = "rejected"
+)
+
+// Visible reports whether the question
+// can be shown to the public
+func (q *Question) Visible() bool {
+	return q.Moderation == "" || q.Moderation == ModerationApproved
 }
 
 type Session struct {
@@ -80,6 +179,19 @@ type Event struct {
 	Rooms       []Room        `json:"rooms"`
 	Sessions    []Session     `json:"sessions"`
 	Speakers    []string      `json:"speakers"`
+	// Moderated events keep the new
+	// questions pending until approved
+	Moderated bool `json:"moderated"`
+	// Language selects the word list of
+	// content filter, empty for all
+	Language string `json:"language"`
+	// ContentPolicy is applied to question
+	// violating the content filters, empty
+	// for the configured default
+	ContentPolicy string `json:"contentPolicy"`
+	// RateLimits override the rate limits
+	// of routes, e.g. {"question": "10/1m"}
+	RateLimits map[string]string `json:"rateLimits,omitempty"`
 }
 
 type EventStorage interface {
@@ -87,13 +199,46 @@ type EventStorage interface {
 	UpdateEvent(event *Event) error
 	DeleteEvent(eventID string) error
 	EventByToken(token string) (*Event, error)
+	EventById(hexId string) (*Event, error)
+	// EventsPage returns the page of events
+	// of creator selected by query
+	EventsPage(query *EventQuery) (*EventPage, error)
 }
 
 type QuestionStorage interface {
 	InsertQuestion(question *Question) error
 	QuestionById(questionID string) (*Question, error)
-	VoteQuestion(questionID string, incBy int) error
-	QuestionsByEventAndSession(eventtoken, sessionToken string) ([]Question, error)
+	// VoteQuestion applies the vote operation
+	// of client, each client can upvote
+	// the question only once and retract
+	// only its own vote.
+	VoteQuestion(questionID, client string, operation int) error
+	VotesByQuestion(questionID string) ([]Vote, error)
+	// VotesByQuestions returns the
+	// votes of questions in time order
+	VotesByQuestions(questionIDs []bson.ObjectId) ([]Vote, error)
+	// QuestionsByEventAndSession returns
+	// the visible questions of session,
+	// optionally only in given states
+	QuestionsByEventAndSession(eventtoken, sessionToken string, states ...string) ([]Question, error)
+	// QuestionsPage returns the page of visible
+	// questions in posting, top or newest order
+	QuestionsPage(query *QuestionQuery) (*QuestionPage, error)
+	PendingQuestions(eventToken string) ([]Question, error)
+	ModerateQuestion(questionID, moderation string) error
+	// EditQuestion stores the text with the
+	// flags and moderation of the edited text
+	EditQuestion(question *Question) error
+	SetQuestionState(questionID, state string) error
+	DeleteQuestion(questionID string) error
+	QuestionsByAuthor(eventToken, authorHash string) ([]Question, error)
+	// MergeQuestions moves the voters and votes
+	// of source questions to the target and
+	// removes the sources, the missing sources
+	// are skipped. The source is removed only
+	// with the voters moved, so no vote cast
+	// during the merge is lost.
+	MergeQuestions(targetID string, sourceIDs []string) error
 }
 
 type SpeakerStorage interface {
@@ -103,10 +248,212 @@ type SpeakerStorage interface {
 	SpeakersById(hexId []string) ([]*Speaker, error)
 }
 
+// Poll states
+const (
+	PollOpen   = "open"
+	PollClosed = "closed"
+)
+
+var (
+	ErrPollClosed = errors.New("storage: poll is closed")
+	// ErrAlreadyRated is returned for
+	// the second rating of client
+	ErrAlreadyRated = errors.New("storage: client already rated the session")
+)
+
+// Poll is the audience poll of event
+// session, the results are counted
+// in the options
+type Poll struct {
+	ID           bson.ObjectId `bson:"_id" json:"id"`
+	EventToken   string        `json:"eventToken"`
+	SessionToken string        `json:"sessionToken"`
+	Question     string        `json:"question"`
+	Options      []PollOption  `json:"options"`
+	// Multiple polls accept
+	// more options of client
+	Multiple bool   `json:"multiple"`
+	State    string `json:"state"`
+	// Anonymous polls keep no ballots,
+	// only the clients that voted
+	Anonymous  bool  `json:"anonymous"`
+	Voted      int   `json:"voted"`
+	CreateTime int64 `json:"createTime"`
+	// Voters holds the clients
+	// that voted in poll
+	Voters []string `json:"-"`
+}
+
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// Ballot is the vote of client
+// in poll that is not anonymous
+type Ballot struct {
+	ID       bson.ObjectId `bson:"_id" json:"id"`
+	PollID   bson.ObjectId `json:"pollId"`
+	Client   string        `json:"client"`
+	Choices  []int         `json:"choices"`
+	VoteTime int64         `json:"voteTime"`
+}
+
+type PollStorage interface {
+	InsertPoll(poll *Poll) error
+	PollById(pollID string) (*Poll, error)
+	PollsBySession(eventToken, sessionToken string) ([]Poll, error)
+	SetPollState(pollID, state string) error
+	// VotePoll counts the choices of client
+	// in open poll, each client votes once
+	VotePoll(pollID, client string, choices []int) error
+	BallotsByPoll(pollID string) ([]Ballot, error)
+}
+
+// Prompt collects the short audience
+// responses of session aggregated
+// into the word cloud
+type Prompt struct {
+	ID           bson.ObjectId `bson:"_id" json:"id"`
+	EventToken   string        `json:"eventToken"`
+	SessionToken string        `json:"sessionToken"`
+	Question     string        `json:"question"`
+	// Language selects the stopwords
+	// removed from responses
+	Language string `json:"language"`
+	// MaxWords is the largest
+	// number of words of response
+	MaxWords   int    `json:"maxWords"`
+	State      string `json:"state"`
+	Responses  int    `json:"responses"`
+	CreateTime int64  `json:"createTime"`
+	// Counts holds the frequency
+	// of normalized responses
+	Counts map[string]int `json:"-"`
+	// Responders holds the clients
+	// that responded to prompt
+	Responders []string `json:"-"`
+	// Cloud is the view of most
+	// frequent responses
+	Cloud []WordCount `bson:"-" json:"cloud"`
+}
+
+// PromptResponse is the response of
+// client with its normalized words
+type PromptResponse struct {
+	ID           bson.ObjectId `bson:"_id" json:"id"`
+	PromptID     bson.ObjectId `json:"promptId"`
+	Client       string        `json:"client"`
+	Text         string        `json:"text"`
+	Words        string        `json:"words"`
+	ResponseTime int64         `json:"responseTime"`
+}
+
+type PromptStorage interface {
+	InsertPrompt(prompt *Prompt) error
+	PromptById(promptID string) (*Prompt, error)
+	PromptsBySession(eventToken, sessionToken string) ([]Prompt, error)
+	SetPromptState(promptID, state string) error
+	// RespondPrompt counts the normalized words
+	// of client response to open prompt, each
+	// client responds once
+	RespondPrompt(response *PromptResponse) error
+	ResponsesByPrompt(promptID string) ([]PromptResponse, error)
+}
+
+// Rating is the feedback of client
+// to the session that has ended
+type Rating struct {
+	ID           bson.ObjectId `bson:"_id" json:"id"`
+	EventToken   string        `json:"eventToken"`
+	SessionToken string        `json:"sessionToken"`
+	Client       string        `json:"client"`
+	Stars        int           `json:"stars"`
+	Comment      string        `json:"comment,omitempty"`
+	RateTime     int64         `json:"rateTime"`
+}
+
+// RatingSummary aggregates the ratings,
+// the Stars holds the number of ratings
+// of one to five stars
+type RatingSummary struct {
+	SessionToken string  `bson:"_id" json:"sessionToken,omitempty"`
+	Count        int     `json:"count"`
+	Sum          int     `json:"-"`
+	Average      float64 `bson:"-" json:"average"`
+	Stars        [5]int  `bson:"-" json:"stars"`
+}
+
+// add counts the ratings of other summary
+func (s *RatingSummary) add(other *RatingSummary) {
+	s.Count += other.Count
+	s.Sum += other.Sum
+	for i := range s.Stars {
+		s.Stars[i] += other.Stars[i]
+	}
+	if s.Count > 0 {
+		s.Average = float64(s.Sum) / float64(s.Count)
+	}
+}
+
+type RatingStorage interface {
+	// InsertRating stores the rating,
+	// each client rates session once
+	InsertRating(rating *Rating) error
+	RatingsBySession(eventToken, sessionToken string) ([]Rating, error)
+	// RatingSummaries aggregates the
+	// ratings of event per session
+	RatingSummaries(eventToken string) ([]RatingSummary, error)
+}
+
+// SessionActivity aggregates the
+// visible questions of session
+type SessionActivity struct {
+	SessionToken string `bson:"_id" json:"sessionToken"`
+	Questions    int    `json:"questions"`
+	Votes        int    `json:"votes"`
+	Answered     int    `json:"answered"`
+}
+
+// SessionParticipants is the number of
+// distinct clients that posted or
+// voted in the session
+type SessionParticipants struct {
+	SessionToken string `bson:"_id" json:"sessionToken"`
+	Participants int    `json:"participants"`
+}
+
+// SessionPeak is the largest number of
+// concurrent connections of session, the
+// empty session holds the peak of event
+type SessionPeak struct {
+	EventToken   string `json:"eventToken"`
+	SessionToken string `json:"sessionToken"`
+	Peak         int    `json:"peak"`
+	PeakTime     int64  `json:"peakTime"`
+}
+
+type ReportStorage interface {
+	// SessionActivities aggregates the
+	// questions of event per session
+	SessionActivities(eventToken string) ([]SessionActivity, error)
+	// Participants counts the distinct clients
+	// of event per session and in whole event
+	Participants(eventToken string) ([]SessionParticipants, int, error)
+	// RecordPeak raises the peak of session
+	// if the count is larger than the stored
+	RecordPeak(eventToken, sessionToken string, count int, peakTime int64) error
+	SessionPeaks(eventToken string) ([]SessionPeak, error)
+}
+
 type DataStorage interface {
 	EventStorage
 	QuestionStorage
 	SpeakerStorage
+	PollStorage
+	PromptStorage
+	RatingStorage
+	ReportStorage
 	OpenSession() error
 	CloseSession()
 }
@@ -117,11 +464,25 @@ type MgoDataStorage struct {
 	events           string
 	questions        string
 	speakers         string
+	votes            string
+	polls            string
+	ballots          string
+	prompts          string
+	responses        string
+	ratings          string
+	peaks            string
 	mgoSession       *mgo.Session
 	mgoDB            *mgo.Database
 	mgoEvents        *mgo.Collection
 	mgoQuestions     *mgo.Collection
 	mgoSpeakers      *mgo.Collection
+	mgoVotes         *mgo.Collection
+	mgoPolls         *mgo.Collection
+	mgoBallots       *mgo.Collection
+	mgoPrompts       *mgo.Collection
+	mgoResponses     *mgo.Collection
+	mgoRatings       *mgo.Collection
+	mgoPeaks         *mgo.Collection
 }
 
 func NewMgoStorage() *MgoDataStorage {
@@ -131,6 +492,13 @@ func NewMgoStorage() *MgoDataStorage {
 		events:           "events",
 		questions:        "questions",
 		speakers:         "speakers",
+		votes:            "votes",
+		polls:            "polls",
+		ballots:          "ballots",
+		prompts:          "prompts",
+		responses:        "responses",
+		ratings:          "ratings",
+		peaks:            "peaks",
 	}
 }
 
@@ -144,12 +512,23 @@ func (a *MgoDataStorage) OpenSession() error {
 	a.mgoEvents = a.mgoDB.C(a.events)
 	a.mgoQuestions = a.mgoDB.C(a.questions)
 	a.mgoSpeakers = a.mgoDB.C(a.speakers)
+	a.mgoVotes = a.mgoDB.C(a.votes)
+	a.mgoPolls = a.mgoDB.C(a.polls)
+	a.mgoBallots = a.mgoDB.C(a.ballots)
+	a.mgoPrompts = a.mgoDB.C(a.prompts)
+	a.mgoResponses = a.mgoDB.C(a.responses)
+	a.mgoRatings = a.mgoDB.C(a.ratings)
+	a.mgoPeaks = a.mgoDB.C(a.peaks)
 
 	a.mgoEvents.EnsureIndex(mgo.Index{
 		Key:        []string{"eventtoken"},
 		Unique:     true,
 		Background: true,
 	})
+	a.mgoEvents.EnsureIndex(mgo.Index{
+		Key:        []string{"createdby", "fromdate"},
+		Background: true,
+	})
 	a.mgoQuestions.EnsureIndex(mgo.Index{
 		Key:        []string{"eventtoken"},
 		Background: true,
@@ -158,6 +537,40 @@ func (a *MgoDataStorage) OpenSession() error {
 		Key:        []string{"sessionname"},
 		Background: true,
 	})
+	a.mgoVotes.EnsureIndex(mgo.Index{
+		Key:        []string{"questionid"},
+		Background: true,
+	})
+	a.mgoQuestions.EnsureIndex(mgo.Index{
+		Key:        []string{"eventtoken", "authorhash"},
+		Background: true,
+	})
+	a.mgoPolls.EnsureIndex(mgo.Index{
+		Key:        []string{"eventtoken", "sessiontoken"},
+		Background: true,
+	})
+	a.mgoBallots.EnsureIndex(mgo.Index{
+		Key:        []string{"pollid"},
+		Background: true,
+	})
+	a.mgoPrompts.EnsureIndex(mgo.Index{
+		Key:        []string{"eventtoken", "sessiontoken"},
+		Background: true,
+	})
+	a.mgoResponses.EnsureIndex(mgo.Index{
+		Key:        []string{"promptid"},
+		Background: true,
+	})
+	a.mgoRatings.EnsureIndex(mgo.Index{
+		Key:        []string{"eventtoken", "sessiontoken", "client"},
+		Unique:     true,
+		Background: true,
+	})
+	a.mgoPeaks.EnsureIndex(mgo.Index{
+		Key:        []string{"eventtoken", "sessiontoken"},
+		Unique:     true,
+		Background: true,
+	})
 	return nil
 }
 
@@ -212,6 +625,17 @@ func (m *MgoDataStorage) UpdateEvent(event *Event) error {
 	return m.mgoEvents.UpdateId(event.ID, event)
 }
 
+func (m *MgoDataStorage) EventById(hexId string) (*Event, error) {
+	if !bson.IsObjectIdHex(hexId) {
+		return nil, mgo.ErrNotFound
+	}
+	result := &Event{}
+	if err := m.mgoEvents.FindId(bson.ObjectIdHex(hexId)).One(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (m *MgoDataStorage) DeleteEvent(eventId string) error {
 	return m.mgoEvents.RemoveId(bson.ObjectIdHex(eventId))
 }
@@ -222,13 +646,86 @@ func (m *MgoDataStorage) EventByToken(token string) (*Event, error) {
 	return result, err
 }
 
+func (m *MgoDataStorage) EventsPage(query *EventQuery) (*EventPage, error) {
+	conditions := []bson.M{{"createdby": query.CreatedBy}}
+	if query.From > 0 {
+		conditions = append(conditions, bson.M{"todate": bson.M{"$gte": query.From}})
+	}
+	if query.To > 0 {
+		conditions = append(conditions, bson.M{"fromdate": bson.M{"$lte": query.To}})
+	}
+	switch query.Status {
+	case EventUpcoming:
+		conditions = append(conditions, bson.M{"fromdate": bson.M{"$gt": query.Now}})
+	case EventLive:
+		conditions = append(conditions,
+			bson.M{"fromdate": bson.M{"$lte": query.Now}},
+			bson.M{"todate": bson.M{"$gt": query.Now}})
+	case EventPast:
+		conditions = append(conditions, bson.M{"todate": bson.M{"$lte": query.Now}})
+	}
+	if len(query.Text) > 0 {
+		text := bson.RegEx{Pattern: regexp.QuoteMeta(query.Text), Options: "i"}
+		conditions = append(conditions, bson.M{"$or": []bson.M{{"name": text}, {"description": text}}})
+	}
+	find := m.mgoEvents.Find(bson.M{"$and": conditions})
+	total, err := find.Count()
+	if err != nil {
+		return nil, err
+	}
+	field := "fromdate"
+	if strings.TrimPrefix(query.Sort, "-") == EventSortName {
+		field = "name"
+	}
+	id := "_id"
+	if strings.HasPrefix(query.Sort, "-") {
+		field, id = "-"+field, "-_id"
+	}
+	page := &EventPage{Events: make([]Event, 0), Total: total}
+	err = find.Sort(field, id).Skip(query.Offset).Limit(query.Limit).All(&page.Events)
+	return page, err
+}
+
 func (m *MgoDataStorage) InsertQuestion(question *Question) error {
 	question.ID = bson.NewObjectId()
 	return m.mgoQuestions.Insert(question)
 }
 
-func (m *MgoDataStorage) VoteQuestion(questionId string, incBy int) error {
-	return m.mgoQuestions.UpdateId(bson.ObjectIdHex(questionId), bson.M{"$inc": bson.M{"vote": incBy}})
+func (m *MgoDataStorage) VoteQuestion(questionId, client string, operation int) error {
+	id := bson.ObjectIdHex(questionId)
+	// The voters condition in selector makes
+	// the check and update of vote atomic
+	selector := bson.M{"_id": id, "voters": bson.M{"$ne": client}}
+	update := bson.M{"$inc": bson.M{"vote": 1}, "$addToSet": bson.M{"voters": client}}
+	opErr := ErrAlreadyVoted
+	if operation == OperationRetract {
+		selector = bson.M{"_id": id, "voters": client}
+		update = bson.M{"$inc": bson.M{"vote": -1}, "$pull": bson.M{"voters": client}}
+		opErr = ErrNotVoted
+	}
+	err := m.mgoQuestions.Update(selector, update)
+	if err == mgo.ErrNotFound {
+		if n, cErr := m.mgoQuestions.FindId(id).Count(); cErr != nil || n == 0 {
+			return err
+		}
+		return opErr
+	}
+	if err != nil {
+		return err
+	}
+	return m.mgoVotes.Insert(newVote(id, client, operation))
+}
+
+func (m *MgoDataStorage) VotesByQuestion(questionID string) ([]Vote, error) {
+	result := make([]Vote, 0)
+	err := m.mgoVotes.Find(bson.M{"questionid": bson.ObjectIdHex(questionID)}).Sort("votetime").All(&result)
+	return result, err
+}
+
+func (m *MgoDataStorage) VotesByQuestions(questionIDs []bson.ObjectId) ([]Vote, error) {
+	result := make([]Vote, 0)
+	err := m.mgoVotes.Find(bson.M{"questionid": bson.M{"$in": questionIDs}}).Sort("votetime", "_id").All(&result)
+	return result, err
 }
 
 func (m *MgoDataStorage) QuestionById(questionID string) (*Question, error) {
@@ -237,12 +734,474 @@ func (m *MgoDataStorage) QuestionById(questionID string) (*Question, error) {
 	return result, err
 }
 
-func (m *MgoDataStorage) QuestionsByEventAndSession(eventToken, sessiontToken string) ([]Question, error) {
+func (m *MgoDataStorage) QuestionsByEventAndSession(eventToken, sessiontToken string, states ...string) ([]Question, error) {
+	result := make([]Question, 0)
+	err := m.mgoQuestions.Find(visibleQuestions(eventToken, sessiontToken, states)).All(&result)
+	return result, err
+}
+
+func (m *MgoDataStorage) QuestionsPage(query *QuestionQuery) (*QuestionPage, error) {
+	selector := visibleQuestions(query.EventToken, query.SessionToken, query.States)
+	order := []string{"_id"}
+	switch query.Sort {
+	case SortTop:
+		order = []string{"-vote", "-_id"}
+	case SortNewest:
+		order = []string{"-_id"}
+	}
+	if c := query.After; c != nil {
+		switch query.Sort {
+		case SortTop:
+			selector["$or"] = []bson.M{
+				{"vote": bson.M{"$lt": c.Vote}},
+				{"vote": c.Vote, "_id": bson.M{"$lt": c.ID}},
+			}
+		case SortNewest:
+			selector["_id"] = bson.M{"$lt": c.ID}
+		default:
+			selector["_id"] = bson.M{"$gt": c.ID}
+		}
+	}
+	result := make([]Question, 0)
+	// One more question tells
+	// whether next page exists
+	err := m.mgoQuestions.Find(selector).Sort(order...).Limit(query.Limit + 1).All(&result)
+	if err != nil {
+		return nil, err
+	}
+	return newQuestionPage(result, query), nil
+}
+
+// visibleQuestions returns the selector of
+// visible questions of session in states
+func visibleQuestions(eventToken, sessionToken string, states []string) bson.M {
+	selector := bson.M{
+		"eventtoken":   eventToken,
+		"sessiontoken": sessionToken,
+		"moderation":   bson.M{"$nin": []string{ModerationPending, ModerationRejected}},
+	}
+	if len(states) > 0 {
+		in := make([]interface{}, 0)
+		for _, state := range states {
+			in = append(in, state)
+			// Questions stored before
+			// the lifecycle have no state
+			if state == StateOpen {
+				in = append(in, nil, "")
+			}
+		}
+		selector["state"] = bson.M{"$in": in}
+	}
+	return selector
+}
+
+// newQuestionPage cuts the questions loaded
+// over the limit and sets the next cursor
+func newQuestionPage(questions []Question, query *QuestionQuery) *QuestionPage {
+	page := &QuestionPage{Questions: questions}
+	if query.Limit > 0 && len(questions) > query.Limit {
+		page.Questions = questions[:query.Limit]
+		page.Next = cursorOf(&page.Questions[query.Limit-1], query.Sort).Encode()
+	}
+	return page
+}
+
+func (m *MgoDataStorage) PendingQuestions(eventToken string) ([]Question, error) {
+	result := make([]Question, 0)
+	err := m.mgoQuestions.Find(bson.M{"eventtoken": eventToken, "moderation": ModerationPending}).All(&result)
+	return result, err
+}
+
+func (m *MgoDataStorage) ModerateQuestion(questionID, moderation string) error {
+	return m.mgoQuestions.UpdateId(bson.ObjectIdHex(questionID), bson.M{"$set": bson.M{"moderation": moderation}})
+}
+
+func (m *MgoDataStorage) EditQuestion(question *Question) error {
+	return m.mgoQuestions.UpdateId(question.ID, bson.M{"$set": bson.M{
+		"question":   question.Question,
+		"flags":      question.Flags,
+		"moderation": question.Moderation,
+	}})
+}
+
+func (m *MgoDataStorage) QuestionsByAuthor(eventToken, authorHash string) ([]Question, error) {
 	result := make([]Question, 0)
-	err := m.mgoQuestions.Find(bson.M{"eventtoken": eventToken, "sessiontoken": sessiontToken}).All(&result)
+	err := m.mgoQuestions.Find(bson.M{"eventtoken": eventToken, "authorhash": authorHash}).All(&result)
+	return result, err
+}
+
+func (m *MgoDataStorage) MergeQuestions(targetID string, sourceIDs []string) error {
+	if !bson.IsObjectIdHex(targetID) {
+		return mgo.ErrNotFound
+	}
+	target := bson.ObjectIdHex(targetID)
+	for _, hexID := range sourceIDs {
+		if !bson.IsObjectIdHex(hexID) {
+			continue
+		}
+		id := bson.ObjectIdHex(hexID)
+		if err := m.mergeSource(target, id); err != nil {
+			return err
+		}
+		// The votes are moved with each removed
+		// source, so the failure of later source
+		// leaves no votes of removed questions
+		_, err := m.mgoVotes.UpdateAll(bson.M{"questionid": id}, bson.M{"$set": bson.M{"questionid": target}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeSource joins the voters of source to
+// the target and removes the source if its
+// voters did not change meanwhile, otherwise
+// the new voters are joined again. The source
+// removed meanwhile is skipped.
+func (m *MgoDataStorage) mergeSource(target, id bson.ObjectId) error {
+	for i := 0; i < mergeRetries; i++ {
+		source := &Question{}
+		err := m.mgoQuestions.FindId(id).One(source)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := m.joinVoters(target, source.Voters); err != nil {
+			return err
+		}
+		err = m.mgoQuestions.Remove(bson.M{"_id": id, "voters": votersSelector(source.Voters)})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return ErrMergeConflict
+}
+
+// joinVoters adds the voters to the target
+// and sets its vote to the number of voters,
+// the update is applied only to the target
+// with the voters read, so the concurrent
+// votes are not overwritten. The client voting
+// for more of the questions is counted once.
+func (m *MgoDataStorage) joinVoters(target bson.ObjectId, voters []string) error {
+	for i := 0; i < mergeRetries; i++ {
+		merged := &Question{}
+		if err := m.mgoQuestions.FindId(target).One(merged); err != nil {
+			return err
+		}
+		joined := append([]string{}, merged.Voters...)
+		seen := make(map[string]bool)
+		for _, voter := range joined {
+			seen[voter] = true
+		}
+		for _, voter := range voters {
+			if !seen[voter] {
+				seen[voter] = true
+				joined = append(joined, voter)
+			}
+		}
+		err := m.mgoQuestions.Update(
+			bson.M{"_id": target, "voters": votersSelector(merged.Voters)},
+			bson.M{"$set": bson.M{"voters": joined, "vote": len(joined)}})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return ErrMergeConflict
+}
+
+// votersSelector matches the voters of question
+// exactly, the question without voters has
+// empty array or no voters field
+func votersSelector(voters []string) interface{} {
+	if len(voters) == 0 {
+		return bson.M{"$in": []interface{}{nil, []string{}}}
+	}
+	return voters
+}
+
+func (m *MgoDataStorage) DeleteQuestion(questionID string) error {
+	id := bson.ObjectIdHex(questionID)
+	if err := m.mgoQuestions.RemoveId(id); err != nil {
+		return err
+	}
+	_, err := m.mgoVotes.RemoveAll(bson.M{"questionid": id})
+	return err
+}
+
+func (m *MgoDataStorage) SetQuestionState(questionID, state string) error {
+	return m.mgoQuestions.UpdateId(bson.ObjectIdHex(questionID), bson.M{"$set": bson.M{"state": state}})
+}
+
+func newVote(questionID bson.ObjectId, client string, operation int) *Vote {
+	if operation != OperationRetract {
+		operation = OperationUpvote
+	}
+	return &Vote{
+		ID:         bson.NewObjectId(),
+		QuestionID: questionID,
+		Client:     client,
+		VoteTime:   time.Now().Unix(),
+		Operation:  operation,
+	}
+}
+
+func (m *MgoDataStorage) InsertPoll(poll *Poll) error {
+	poll.ID = bson.NewObjectId()
+	return m.mgoPolls.Insert(poll)
+}
+
+func (m *MgoDataStorage) PollById(pollID string) (*Poll, error) {
+	poll := &Poll{}
+	err := m.mgoPolls.FindId(bson.ObjectIdHex(pollID)).One(poll)
+	return poll, err
+}
+
+func (m *MgoDataStorage) PollsBySession(eventToken, sessionToken string) ([]Poll, error) {
+	result := make([]Poll, 0)
+	err := m.mgoPolls.Find(bson.M{"eventtoken": eventToken, "sessiontoken": sessionToken}).All(&result)
+	return result, err
+}
+
+func (m *MgoDataStorage) SetPollState(pollID, state string) error {
+	return m.mgoPolls.UpdateId(bson.ObjectIdHex(pollID), bson.M{"$set": bson.M{"state": state}})
+}
+
+func (m *MgoDataStorage) VotePoll(pollID, client string, choices []int) error {
+	id := bson.ObjectIdHex(pollID)
+	// The state and voters conditions in selector
+	// make the check and update of vote atomic
+	inc := bson.M{"voted": 1}
+	for _, choice := range choices {
+		inc[fmt.Sprintf("options.%d.votes", choice)] = 1
+	}
+	err := m.mgoPolls.Update(
+		bson.M{"_id": id, "state": PollOpen, "voters": bson.M{"$ne": client}},
+		bson.M{"$inc": inc, "$addToSet": bson.M{"voters": client}})
+	if err == mgo.ErrNotFound {
+		poll := &Poll{}
+		if fErr := m.mgoPolls.FindId(id).One(poll); fErr != nil {
+			return err
+		}
+		if poll.State != PollOpen {
+			return ErrPollClosed
+		}
+		return ErrAlreadyVoted
+	}
+	if err != nil {
+		return err
+	}
+	poll := &Poll{}
+	if err := m.mgoPolls.FindId(id).Select(bson.M{"anonymous": 1}).One(poll); err != nil || poll.Anonymous {
+		return err
+	}
+	return m.mgoBallots.Insert(newBallot(id, client, choices))
+}
+
+func (m *MgoDataStorage) BallotsByPoll(pollID string) ([]Ballot, error) {
+	result := make([]Ballot, 0)
+	err := m.mgoBallots.Find(bson.M{"pollid": bson.ObjectIdHex(pollID)}).Sort("votetime").All(&result)
+	return result, err
+}
+
+func newBallot(pollID bson.ObjectId, client string, choices []int) *Ballot {
+	return &Ballot{
+		ID:       bson.NewObjectId(),
+		PollID:   pollID,
+		Client:   client,
+		Choices:  choices,
+		VoteTime: time.Now().Unix(),
+	}
+}
+
+func (m *MgoDataStorage) InsertPrompt(prompt *Prompt) error {
+	prompt.ID = bson.NewObjectId()
+	return m.mgoPrompts.Insert(prompt)
+}
+
+func (m *MgoDataStorage) PromptById(promptID string) (*Prompt, error) {
+	prompt := &Prompt{}
+	err := m.mgoPrompts.FindId(bson.ObjectIdHex(promptID)).One(prompt)
+	return prompt, err
+}
+
+func (m *MgoDataStorage) PromptsBySession(eventToken, sessionToken string) ([]Prompt, error) {
+	result := make([]Prompt, 0)
+	err := m.mgoPrompts.Find(bson.M{"eventtoken": eventToken, "sessiontoken": sessionToken}).All(&result)
+	return result, err
+}
+
+func (m *MgoDataStorage) SetPromptState(promptID, state string) error {
+	return m.mgoPrompts.UpdateId(bson.ObjectIdHex(promptID), bson.M{"$set": bson.M{"state": state}})
+}
+
+func (m *MgoDataStorage) RespondPrompt(response *PromptResponse) error {
+	// The normalized words contain only letters,
+	// digits and spaces, so they are safe keys
+	err := m.mgoPrompts.Update(
+		bson.M{"_id": response.PromptID, "state": PollOpen, "responders": bson.M{"$ne": response.Client}},
+		bson.M{
+			"$inc":      bson.M{"counts." + response.Words: 1, "responses": 1},
+			"$addToSet": bson.M{"responders": response.Client},
+		})
+	if err == mgo.ErrNotFound {
+		prompt := &Prompt{}
+		if fErr := m.mgoPrompts.FindId(response.PromptID).One(prompt); fErr != nil {
+			return err
+		}
+		if prompt.State != PollOpen {
+			return ErrPollClosed
+		}
+		return ErrAlreadyVoted
+	}
+	if err != nil {
+		return err
+	}
+	response.ID = bson.NewObjectId()
+	return m.mgoResponses.Insert(response)
+}
+
+func (m *MgoDataStorage) ResponsesByPrompt(promptID string) ([]PromptResponse, error) {
+	result := make([]PromptResponse, 0)
+	err := m.mgoResponses.Find(bson.M{"promptid": bson.ObjectIdHex(promptID)}).Sort("responsetime").All(&result)
 	return result, err
 }
 
+func (m *MgoDataStorage) InsertRating(rating *Rating) error {
+	rating.ID = bson.NewObjectId()
+	err := m.mgoRatings.Insert(rating)
+	if mgo.IsDup(err) {
+		return ErrAlreadyRated
+	}
+	return err
+}
+
+func (m *MgoDataStorage) RatingsBySession(eventToken, sessionToken string) ([]Rating, error) {
+	result := make([]Rating, 0)
+	err := m.mgoRatings.Find(bson.M{"eventtoken": eventToken, "sessiontoken": sessionToken}).Sort("ratetime").All(&result)
+	return result, err
+}
+
+func (m *MgoDataStorage) RatingSummaries(eventToken string) ([]RatingSummary, error) {
+	group := bson.M{
+		"_id":   "$sessiontoken",
+		"count": bson.M{"$sum": 1},
+		"sum":   bson.M{"$sum": "$stars"},
+	}
+	for stars := 1; stars <= 5; stars++ {
+		group[fmt.Sprintf("stars%d", stars)] = bson.M{"$sum": bson.M{"$cond": []interface{}{
+			bson.M{"$eq": []interface{}{"$stars", stars}}, 1, 0,
+		}}}
+	}
+	groups := make([]bson.M, 0)
+	err := m.mgoRatings.Pipe([]bson.M{
+		{"$match": bson.M{"eventtoken": eventToken}},
+		{"$group": group},
+	}).All(&groups)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]RatingSummary, 0, len(groups))
+	for _, g := range groups {
+		summary := RatingSummary{}
+		summary.SessionToken, _ = g["_id"].(string)
+		for stars := 1; stars <= 5; stars++ {
+			summary.Stars[stars-1] = bsonInt(g[fmt.Sprintf("stars%d", stars)])
+		}
+		summary.add(&RatingSummary{Count: bsonInt(g["count"]), Sum: bsonInt(g["sum"])})
+		result = append(result, summary)
+	}
+	return result, nil
+}
+
+func (m *MgoDataStorage) SessionActivities(eventToken string) ([]SessionActivity, error) {
+	result := make([]SessionActivity, 0)
+	err := m.mgoQuestions.Pipe([]bson.M{
+		{"$match": bson.M{
+			"eventtoken": eventToken,
+			"moderation": bson.M{"$nin": []string{ModerationPending, ModerationRejected}},
+		}},
+		{"$group": bson.M{
+			"_id":       "$sessiontoken",
+			"questions": bson.M{"$sum": 1},
+			"votes":     bson.M{"$sum": "$vote"},
+			"answered": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$eq": []interface{}{"$state", StateAnswered}}, 1, 0,
+			}}},
+		}},
+	}).All(&result)
+	return result, err
+}
+
+func (m *MgoDataStorage) Participants(eventToken string) ([]SessionParticipants, int, error) {
+	// The votes are looked up from the questions
+	// of event by the questionid index, the
+	// clients are counted inside of the pipeline
+	clients := []bson.M{
+		{"$match": bson.M{"eventtoken": eventToken}},
+		{"$lookup": bson.M{"from": m.votes, "localField": "_id", "foreignField": "questionid", "as": "votes"}},
+		{"$project": bson.M{
+			"sessiontoken": 1,
+			"clients":      bson.M{"$concatArrays": []interface{}{[]interface{}{"$client"}, "$votes.client"}},
+		}},
+		{"$unwind": "$clients"},
+		{"$match": bson.M{"clients": bson.M{"$nin": []interface{}{nil, ""}}}},
+		{"$group": bson.M{"_id": bson.M{"sessiontoken": "$sessiontoken", "client": "$clients"}}},
+	}
+	result := make([]SessionParticipants, 0)
+	err := m.mgoQuestions.Pipe(append(clients,
+		bson.M{"$group": bson.M{"_id": "$_id.sessiontoken", "participants": bson.M{"$sum": 1}}},
+	)).All(&result)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := bson.M{}
+	err = m.mgoQuestions.Pipe(append(clients,
+		bson.M{"$group": bson.M{"_id": "$_id.client"}},
+		bson.M{"$group": bson.M{"_id": nil, "count": bson.M{"$sum": 1}}},
+	)).One(&total)
+	if err == mgo.ErrNotFound {
+		return result, 0, nil
+	}
+	return result, bsonInt(total["count"]), err
+}
+
+func (m *MgoDataStorage) RecordPeak(eventToken, sessionToken string, count int, peakTime int64) error {
+	// The lower peak is replaced, the existing
+	// larger peak fails the upsert on the
+	// unique index and is kept
+	_, err := m.mgoPeaks.Upsert(
+		bson.M{"eventtoken": eventToken, "sessiontoken": sessionToken, "peak": bson.M{"$lt": count}},
+		bson.M{"$set": bson.M{"peak": count, "peaktime": peakTime}})
+	if mgo.IsDup(err) {
+		return nil
+	}
+	return err
+}
+
+func (m *MgoDataStorage) SessionPeaks(eventToken string) ([]SessionPeak, error) {
+	result := make([]SessionPeak, 0)
+	err := m.mgoPeaks.Find(bson.M{"eventtoken": eventToken}).Select(bson.M{"_id": 0}).All(&result)
+	return result, err
+}
+
+// bsonInt converts the number
+// of aggregation result
+func bsonInt(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
 func generateToken(length int) string {
 	token := uuid.NewV4()
 	sha := sha256.Sum256(token.Bytes())
@@ -38,6 +38,10 @@ func TestInsertEvent(t *testing.T) {
 		[]Room{},
 		[]Session{},
 		[]string{},
+		false,
+		"",
+		"",
+		nil,
 	}
 
 	storage.InsertEvent(event)
@@ -175,3 +179,47 @@ func TestInserCompleteEvent(t *testing.T) {
 	// mongo.InsertEvent(event)
 
 }
+
+func TestMgoMergeQuestions(t *testing.T) {
+	storage := createMgoStorage()
+	defer cleanUp(storage)
+
+	questions := make([]*Question, 3)
+	for i := range questions {
+		questions[i] = &Question{EventToken: "abcd", SessionToken: "1234", Question: fmt.Sprintf("question %d", i)}
+		if err := storage.InsertQuestion(questions[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target, first, second := questions[0].ID.Hex(), questions[1].ID.Hex(), questions[2].ID.Hex()
+	for id, clients := range map[string][]string{target: {"a"}, first: {"a", "b"}, second: {"c"}} {
+		for _, client := range clients {
+			if err := storage.VoteQuestion(id, client, OperationUpvote); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	missing := bson.NewObjectId().Hex()
+	if err := storage.MergeQuestions(target, []string{first, missing, second}); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := storage.QuestionById(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Vote != 3 || len(merged.Voters) != 3 {
+		t.Errorf("Unexpected merged question %v", merged)
+	}
+	for _, id := range []string{first, second} {
+		if _, err := storage.QuestionById(id); err == nil {
+			t.Errorf("Source %s not removed", id)
+		}
+		if votes, _ := storage.VotesByQuestion(id); len(votes) != 0 {
+			t.Errorf("Votes of removed source %s left", id)
+		}
+	}
+	if votes, _ := storage.VotesByQuestion(target); len(votes) != 4 {
+		t.Errorf("Votes not moved to target %v", votes)
+	}
+}
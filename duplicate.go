@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MaxDuplicates is the largest number
+// of duplicates suggested to client
+const MaxDuplicates = 3
+
+// DuplicateError is returned for question
+// similar to the existing questions of
+// session, the client is suggested to
+// upvote one of them instead
+type DuplicateError struct {
+	Duplicates []Question
+}
+
+func (e *DuplicateError) Error() string {
+	return "question: similar question already asked, consider voting for it"
+}
+
+// DuplicateSuggestion is the response
+// to the duplicate question
+type DuplicateSuggestion struct {
+	Message    string     `json:"message"`
+	Duplicates []Question `json:"duplicates"`
+}
+
+// MergeRequest is the body of merge request
+// with the questions merged into the target
+type MergeRequest struct {
+	From []string `json:"from"`
+}
+
+// shingles returns the set of normalized word
+// tokens and word pairs of text, so both the
+// shared words and the shared phrases count
+func shingles(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	result := make(map[string]bool)
+	for i, word := range words {
+		result[word] = true
+		if i > 0 {
+			result[words[i-1]+" "+word] = true
+		}
+	}
+	return result
+}
+
+// similarity returns the Jaccard similarity
+// of the shingle sets of texts
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for s := range a {
+		if b[s] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+type bySimilarity struct {
+	questions []Question
+	scores    []float64
+}
+
+func (s bySimilarity) Len() int { return len(s.questions) }
+func (s bySimilarity) Swap(i, j int) {
+	s.questions[i], s.questions[j] = s.questions[j], s.questions[i]
+	s.scores[i], s.scores[j] = s.scores[j], s.scores[i]
+}
+func (s bySimilarity) Less(i, j int) bool { return s.scores[i] > s.scores[j] }
+
+// findDuplicates returns the visible questions
+// of session similar to the question, the most
+// similar first
+func findDuplicates(question *Question) ([]Question, error) {
+	questions, err := mongo.QuestionsByEventAndSession(question.EventToken, question.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+	text := shingles(question.Question)
+	found := bySimilarity{}
+	for _, q := range questions {
+		score := similarity(text, shingles(q.Question))
+		if score >= questionCfg.DuplicateThreshold {
+			found.questions = append(found.questions, q)
+			found.scores = append(found.scores, score)
+		}
+	}
+	sort.Stable(found)
+	if len(found.questions) > MaxDuplicates {
+		return found.questions[:MaxDuplicates], nil
+	}
+	return found.questions, nil
+}
+
+func mergeQuestions(c *gin.Context) {
+	merge := &MergeRequest{}
+	if err := c.BindJSON(merge); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the merge")
+		return
+	}
+	if ownedQuestion(c, c.Params.ByName("questionID")) == nil {
+		return
+	}
+	q, err := applyMerge(c.Params.ByName("questionID"), merge.From)
+	writeQuestionResult(c, q, err)
+}
+
+// applyMerge merges the questions into the
+// target question of the same session and
+// notifies the session subscribers
+func applyMerge(targetID string, sourceIDs []string) (*Question, error) {
+	if len(sourceIDs) == 0 {
+		return nil, ErrMergeEmpty
+	}
+	if !bson.IsObjectIdHex(targetID) {
+		return nil, mgo.ErrNotFound
+	}
+	target, err := mongo.QuestionById(targetID)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]*Question, 0)
+	unique := make([]string, 0, len(sourceIDs))
+	seen := make(map[string]bool)
+	for _, id := range sourceIDs {
+		if id == targetID {
+			return nil, ErrMergeInvalid
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+		if !bson.IsObjectIdHex(id) {
+			return nil, mgo.ErrNotFound
+		}
+		source, err := mongo.QuestionById(id)
+		if err != nil {
+			return nil, err
+		}
+		if source.EventToken != target.EventToken || source.SessionToken != target.SessionToken {
+			return nil, ErrMergeInvalid
+		}
+		sources = append(sources, source)
+	}
+	if err := mongo.MergeQuestions(targetID, unique); err != nil {
+		return nil, err
+	}
+	merged, err := mongo.QuestionById(targetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		if !source.Visible() {
+			continue
+		}
+		updateErr := notifyChange(source.EventToken, source.SessionToken, MsgQuestionRemoved, &QuestionRef{source.ID, source.Vote})
+		if updateErr != nil {
+			log.Errorln(updateErr)
+		}
+	}
+	if merged.Visible() {
+		updateErr := notifyChange(merged.EventToken, merged.SessionToken, MsgQuestionVoted, &QuestionRef{merged.ID, merged.Vote})
+		if updateErr != nil {
+			log.Errorln(updateErr)
+		}
+	}
+	return merged, nil
+}
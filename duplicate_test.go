@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b      string
+		duplicate bool
+	}{
+		{"What is new in Go?", "what's new in Go", true},
+		{"How do you test the handlers?", "How do you test handlers?!", true},
+		{"What is new in Go?", "Will you share the slides?", false},
+		{"", "Anything", false},
+	}
+	for _, c := range cases {
+		score := similarity(shingles(c.a), shingles(c.b))
+		if (score >= questionCfg.DuplicateThreshold) != c.duplicate {
+			t.Errorf("Unexpected similarity %f of %q and %q", score, c.a, c.b)
+		}
+	}
+}
+
+func TestDuplicateQuestion(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	original := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "What is new in Go?"}
+	createQuestion(original)
+
+	post := func(q *Question) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(q)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/question", bytes.NewReader(body))
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := post(&Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "What's new in Go?"})
+	suggestion := &DuplicateSuggestion{}
+	json.Unmarshal(w.Body.Bytes(), suggestion)
+	if w.Code != http.StatusConflict || len(suggestion.Duplicates) != 1 || suggestion.Duplicates[0].ID != original.ID {
+		t.Fatalf("Duplicate not suggested %d %v", w.Code, suggestion)
+	}
+
+	w = post(&Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "What's new in Go?", Force: true})
+	duplicate := &Question{}
+	json.Unmarshal(w.Body.Bytes(), duplicate)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Forced question not posted %d", w.Code)
+	}
+
+	castVote(original.ID.Hex(), "client1", OperationUpvote)
+	castVote(duplicate.ID.Hex(), "client1", OperationUpvote)
+	castVote(duplicate.ID.Hex(), "client2", OperationUpvote)
+	client := addIdleClient(commMan.(*MapEventManager), event.EventToken, sessionToken)
+
+	if _, err := applyMerge(original.ID.Hex(), []string{original.ID.Hex()}); err != ErrMergeInvalid {
+		t.Error("Question merged into itself")
+	}
+	merged, err := applyMerge(original.ID.Hex(), []string{duplicate.ID.Hex(), duplicate.ID.Hex()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Vote != 2 || len(merged.Voters) != 2 {
+		t.Errorf("Unexpected merged votes %d %v", merged.Vote, merged.Voters)
+	}
+	if votes, _ := storage.VotesByQuestion(original.ID.Hex()); len(votes) != 3 {
+		t.Errorf("Vote history not merged %v", votes)
+	}
+	if _, err := storage.QuestionById(duplicate.ID.Hex()); err == nil {
+		t.Error("Merged question not removed")
+	}
+	if len(client.queue) != 2 {
+		t.Error("Merge not broadcast")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Statuses of event relative
+// to the time of query
+const (
+	EventUpcoming = "upcoming"
+	EventLive     = "live"
+	EventPast     = "past"
+)
+
+// Sort keys of event listing, the
+// key prefixed by minus is descending
+const (
+	EventSortFrom = "from"
+	EventSortName = "name"
+)
+
+// EventQuery selects the page of events
+// created by the organizer. The From and To
+// select the events overlapping the range,
+// the Text is searched in name and description.
+type EventQuery struct {
+	CreatedBy string
+	From      int64
+	To        int64
+	Status    string
+	Text      string
+	Sort      string
+	Now       int64
+	Offset    int
+	Limit     int
+}
+
+// EventPage is the page of events
+// with the number of all matching
+type EventPage struct {
+	Events []Event `json:"events"`
+	Total  int     `json:"total"`
+}
+
+// ValidEventSort reports whether
+// the sort of event listing is known
+func ValidEventSort(sortKey string) bool {
+	switch strings.TrimPrefix(sortKey, "-") {
+	case EventSortFrom, EventSortName:
+		return true
+	}
+	return false
+}
+
+func validEventStatus(status string) bool {
+	switch status {
+	case "", EventUpcoming, EventLive, EventPast:
+		return true
+	}
+	return false
+}
+
+// matches reports whether the
+// event is selected by query
+func (q *EventQuery) matches(e *Event) bool {
+	if e.CreatedBy != q.CreatedBy {
+		return false
+	}
+	if q.From > 0 && e.ToDate < q.From {
+		return false
+	}
+	if q.To > 0 && e.FromDate > q.To {
+		return false
+	}
+	switch q.Status {
+	case EventUpcoming:
+		if e.FromDate <= q.Now {
+			return false
+		}
+	case EventLive:
+		if e.FromDate > q.Now || e.ToDate <= q.Now {
+			return false
+		}
+	case EventPast:
+		if e.ToDate > q.Now {
+			return false
+		}
+	}
+	if len(q.Text) > 0 {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(e.Name), text) &&
+			!strings.Contains(strings.ToLower(e.Description), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// byEventSort orders the events by the sort
+// key of query, the ties by the id
+type byEventSort struct {
+	events []Event
+	key    string
+}
+
+func (s byEventSort) Len() int      { return len(s.events) }
+func (s byEventSort) Swap(i, j int) { s.events[i], s.events[j] = s.events[j], s.events[i] }
+func (s byEventSort) Less(i, j int) bool {
+	a, b := &s.events[i], &s.events[j]
+	if strings.HasPrefix(s.key, "-") {
+		a, b = b, a
+	}
+	switch strings.TrimPrefix(s.key, "-") {
+	case EventSortName:
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+	default:
+		if a.FromDate != b.FromDate {
+			return a.FromDate < b.FromDate
+		}
+	}
+	return a.ID < b.ID
+}
+
+// getEvents lists the page of events created
+// by the authenticated organizer. The from
+// and to parameters are unix times, status is
+// upcoming, live or past, q the searched text,
+// sort the sort key and offset with limit
+// select the page.
+func getEvents(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusUnauthorized, "User not identified")
+		return
+	}
+	query := &EventQuery{
+		CreatedBy: user.Email,
+		Status:    c.Query("status"),
+		Text:      strings.TrimSpace(c.Query("q")),
+		Sort:      c.DefaultQuery("sort", "-"+EventSortFrom),
+		Now:       time.Now().Unix(),
+	}
+	if !validEventStatus(query.Status) {
+		c.JSON(http.StatusBadRequest, "Unknown event status")
+		return
+	}
+	if !ValidEventSort(query.Sort) {
+		c.JSON(http.StatusBadRequest, "Unknown sort key")
+		return
+	}
+	for param, value := range map[string]*int64{"from": &query.From, "to": &query.To} {
+		if raw := c.Query(param); len(raw) > 0 {
+			parsed, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, "Invalid "+param)
+				return
+			}
+			*value = parsed
+		}
+	}
+	for param, value := range map[string]*int{"offset": &query.Offset, "limit": &query.Limit} {
+		if raw := c.Query(param); len(raw) > 0 {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 0 {
+				c.JSON(http.StatusBadRequest, "Invalid "+param)
+				return
+			}
+			*value = parsed
+		}
+	}
+	query.Limit = pageLimit(query.Limit)
+
+	page, err := mongo.EventsPage(query)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load events")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
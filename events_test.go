@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/suricatatalk/gate/auth"
+)
+
+func TestEventsPage(t *testing.T) {
+	storage := setupMemoryBackend()
+	now := time.Now().Unix()
+	day := int64(24 * time.Hour / time.Second)
+	for _, e := range []*Event{
+		{Name: "Past Meetup", CreatedBy: "ann@example.com", FromDate: now - 3*day, ToDate: now - 2*day},
+		{Name: "Live Conference", Description: "Golang talks", CreatedBy: "ann@example.com", FromDate: now - day, ToDate: now + day},
+		{Name: "Upcoming Workshop", CreatedBy: "ann@example.com", FromDate: now + 2*day, ToDate: now + 3*day},
+		{Name: "Other Conference", CreatedBy: "bob@example.com", FromDate: now - day, ToDate: now + day},
+	} {
+		storage.InsertEvent(e)
+	}
+
+	cases := []struct {
+		query *EventQuery
+		names []string
+		total int
+	}{
+		{&EventQuery{Sort: "-from"}, []string{"Upcoming Workshop", "Live Conference", "Past Meetup"}, 3},
+		{&EventQuery{Sort: "name", Limit: 2}, []string{"Live Conference", "Past Meetup"}, 3},
+		{&EventQuery{Sort: "name", Offset: 2}, []string{"Upcoming Workshop"}, 3},
+		{&EventQuery{Status: EventLive}, []string{"Live Conference"}, 1},
+		{&EventQuery{Status: EventPast}, []string{"Past Meetup"}, 1},
+		{&EventQuery{From: now, To: now + 2*day, Sort: "from"}, []string{"Live Conference", "Upcoming Workshop"}, 2},
+		{&EventQuery{Text: "golang"}, []string{"Live Conference"}, 1},
+	}
+	for _, c := range cases {
+		c.query.CreatedBy = "ann@example.com"
+		c.query.Now = now
+		if c.query.Sort == "" {
+			c.query.Sort = "from"
+		}
+		if c.query.Limit == 0 {
+			c.query.Limit = 10
+		}
+		page, _ := storage.EventsPage(c.query)
+		names := make([]string, 0)
+		for _, e := range page.Events {
+			names = append(names, e.Name)
+		}
+		if page.Total != c.total || len(names) != len(c.names) {
+			t.Errorf("Unexpected page %v of %d for %v", names, page.Total, c.query)
+			continue
+		}
+		for i := range names {
+			if names[i] != c.names[i] {
+				t.Errorf("Unexpected page %v for %v", names, c.query)
+				break
+			}
+		}
+	}
+}
+
+func TestGetEvents(t *testing.T) {
+	storage := setupMemoryBackend()
+	storage.InsertEvent(&Event{Name: "Open Zlin", CreatedBy: "ann@example.com", FromDate: 1, ToDate: 2})
+	storage.InsertEvent(&Event{Name: "Other", CreatedBy: "bob@example.com", FromDate: 1, ToDate: 2})
+
+	user, _ := json.Marshal(&auth.User{Email: "ann@example.com"})
+	router := gin.New()
+	router.GET("/events", func(c *gin.Context) {
+		c.Request.Header.Set(TokenHeader, string(user))
+	}, getEvents)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/events?status=past", nil)
+	router.ServeHTTP(w, req)
+	page := &EventPage{}
+	json.Unmarshal(w.Body.Bytes(), page)
+	if w.Code != http.StatusOK || page.Total != 1 || page.Events[0].Name != "Open Zlin" {
+		t.Errorf("Unexpected events %d %v", w.Code, page)
+	}
+
+	for _, path := range []string{"/events?status=soon", "/events?sort=size", "/events?from=yesterday", "/events?offset=-1"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Invalid query %s served %d", path, w.Code)
+		}
+	}
+}
+
+func TestEventCreator(t *testing.T) {
+	storage := setupMemoryBackend()
+	storage.InsertEvent(&Event{Name: "Legacy", FromDate: 1, ToDate: 2})
+
+	// The token without email does
+	// not own the legacy events
+	anonymous, _ := json.Marshal(&auth.User{Username: "ann"})
+	router := gin.New()
+	router.GET("/events", func(c *gin.Context) {
+		c.Request.Header.Set(TokenHeader, string(anonymous))
+	}, getEvents)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/events", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Events listed for user without email %d %s", w.Code, w.Body.String())
+	}
+
+	// The posted creator is replaced
+	// by the email of token
+	for header, createdBy := range map[string]string{
+		`{"email":"ann@example.com"}`: "ann@example.com",
+		string(anonymous):             "",
+	} {
+		event := &Event{Name: "Open Zlin", CreatedBy: "bob@example.com"}
+		router := gin.New()
+		router.POST("/event", func(c *gin.Context) {
+			insertEvent(c, event)
+		})
+		req, _ := http.NewRequest("POST", "/event", nil)
+		req.Header.Set(TokenHeader, header)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if stored, _ := storage.EventByToken(event.EventToken); stored == nil || stored.CreatedBy != createdBy {
+			t.Errorf("Unexpected creator %v for token %s", stored, header)
+		}
+	}
+}
+
+func TestUpdateEventOwner(t *testing.T) {
+	storage := setupMemoryBackend()
+	own := &Event{Name: "Open Zlin", CreatedBy: "ann@example.com", FromDate: 1, ToDate: 2}
+	other := &Event{Name: "Other", CreatedBy: "bob@example.com", FromDate: 1, ToDate: 2}
+	storage.InsertEvent(own)
+	storage.InsertEvent(other)
+
+	update := func(email string, event *Event) int {
+		router := gin.New()
+		router.PUT("/event", organizer(email), func(c *gin.Context) {
+			updateEvent(c, event)
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/event", nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The token of own event does not
+	// allow the update of other event
+	forged := &Event{ID: other.ID, EventToken: own.EventToken, Name: "Taken", CreatedBy: "ann@example.com", FromDate: 1, ToDate: 2}
+	if code := update("ann@example.com", forged); code != http.StatusForbidden {
+		t.Errorf("Event of other user updated %d", code)
+	}
+	if code := update("ann@example.com", &Event{Name: "Missing", FromDate: 1, ToDate: 2}); code != http.StatusNotFound {
+		t.Errorf("Event without id updated %d", code)
+	}
+	renamed := &Event{ID: own.ID, EventToken: own.EventToken, Name: "Open Zlin 2", CreatedBy: "bob@example.com", FromDate: 1, ToDate: 2}
+	if code := update("ann@example.com", renamed); code != http.StatusOK {
+		t.Errorf("Event of owner not updated %d", code)
+	}
+	if stored, _ := storage.EventById(own.ID.Hex()); stored == nil || stored.Name != "Open Zlin 2" || stored.CreatedBy != "ann@example.com" {
+		t.Errorf("Unexpected updated event %v", stored)
+	}
+	if stored, _ := storage.EventById(other.ID.Hex()); stored == nil || stored.Name != "Other" {
+		t.Errorf("Other event changed %v", stored)
+	}
+}
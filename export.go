@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export formats of questions
+const (
+	ExportCSV      = "csv"
+	ExportJSONL    = "jsonl"
+	ExportMarkdown = "md"
+)
+
+// exportContentTypes maps the
+// formats to the content types
+var exportContentTypes = map[string]string{
+	ExportCSV:      "text/csv; charset=utf-8",
+	ExportJSONL:    "application/x-ndjson; charset=utf-8",
+	ExportMarkdown: "text/markdown; charset=utf-8",
+}
+
+// ExportRow is the exported question with
+// the session and room names of event
+type ExportRow struct {
+	ID           string `json:"id"`
+	EventToken   string `json:"eventToken"`
+	EventName    string `json:"eventName"`
+	SessionToken string `json:"sessionToken"`
+	SessionName  string `json:"sessionName"`
+	Room         string `json:"room"`
+	Question     string `json:"question"`
+	Vote         int    `json:"vote"`
+	State        string `json:"state"`
+	CreateTime   int64  `json:"createTime"`
+}
+
+// created returns the posting
+// time of question in UTC
+func (r *ExportRow) created() string {
+	return time.Unix(r.CreateTime, 0).UTC().Format(time.RFC3339)
+}
+
+// exportSection are the rows
+// of single session
+type exportSection struct {
+	session *Session
+	rows    []ExportRow
+}
+
+func getEventExport(c *gin.Context) {
+	exportQuestions(c, "")
+}
+
+func getSessionExport(c *gin.Context) {
+	exportQuestions(c, c.Params.ByName("session"))
+}
+
+// exportQuestions writes the visible questions
+// of event or its single session in format of
+// format parameter, optionally filtered by
+// states and ordered by sort mode
+func exportQuestions(c *gin.Context, sessionToken string) {
+	format := c.DefaultQuery("format", ExportCSV)
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, "Unknown export format")
+		return
+	}
+	sortMode := c.DefaultQuery("sort", SortTop)
+	if !ValidSort(sortMode) {
+		c.JSON(http.StatusBadRequest, "Unknown sort mode")
+		return
+	}
+	states, err := queryStates(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	event := ownedEvent(c, c.Params.ByName("eventtoken"))
+	if event == nil {
+		return
+	}
+	sessions := event.Sessions
+	filename := event.EventToken
+	if len(sessionToken) > 0 {
+		session := sessionByToken(event, sessionToken)
+		if session == nil {
+			c.JSON(http.StatusNotFound, "Session not exist")
+			return
+		}
+		sessions = []Session{*session}
+		filename += "-" + sessionToken
+	}
+
+	sections := make([]exportSection, 0, len(sessions))
+	now := time.Now()
+	for i := range sessions {
+		session := &sessions[i]
+		questions, err := mongo.QuestionsByEventAndSession(event.EventToken, session.SessionToken, states...)
+		if err == nil {
+			err = sortQuestions(questions, sortMode, now)
+		}
+		if err != nil {
+			log.Errorln(err)
+			c.JSON(http.StatusInternalServerError, "Cannot load questions")
+			return
+		}
+		section := exportSection{session, make([]ExportRow, 0, len(questions))}
+		for _, q := range questions {
+			section.rows = append(section.rows, ExportRow{
+				ID:           q.ID.Hex(),
+				EventToken:   event.EventToken,
+				EventName:    event.Name,
+				SessionToken: session.SessionToken,
+				SessionName:  session.Name,
+				Room:         session.Room,
+				Question:     q.Question,
+				Vote:         q.Vote,
+				State:        q.QuestionState(),
+				CreateTime:   q.CreateTime,
+			})
+		}
+		sections = append(sections, section)
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+format))
+	c.Status(http.StatusOK)
+	switch format {
+	case ExportCSV:
+		err = writeCSV(c.Writer, sections)
+	case ExportJSONL:
+		err = writeJSONL(c.Writer, sections)
+	case ExportMarkdown:
+		err = writeMarkdown(c.Writer, event, sections)
+	}
+	if err != nil {
+		log.Errorf("exportQuestions: cannot write export %v", err)
+	}
+}
+
+// csvCell keeps the spreadsheet from
+// reading the text cell as formula
+func csvCell(text string) string {
+	if len(text) > 0 && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func writeCSV(w io.Writer, sections []exportSection) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "session", "room", "question", "votes", "state", "created"})
+	for _, section := range sections {
+		for _, r := range section.rows {
+			out.Write([]string{r.ID, csvCell(r.SessionName), csvCell(r.Room), csvCell(r.Question), strconv.Itoa(r.Vote), r.State, r.created()})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func writeJSONL(w io.Writer, sections []exportSection) error {
+	encoder := json.NewEncoder(w)
+	for _, section := range sections {
+		for i := range section.rows {
+			if err := encoder.Encode(&section.rows[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// markdownEscaper keeps the question
+// text inside of the table cell
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ")
+
+func writeMarkdown(w io.Writer, event *Event, sections []exportSection) error {
+	if _, err := fmt.Fprintf(w, "# %s\n", event.Name); err != nil {
+		return err
+	}
+	for _, section := range sections {
+		title := section.session.Name
+		if len(section.session.Room) > 0 {
+			title += " (" + section.session.Room + ")"
+		}
+		fmt.Fprintf(w, "\n## %s\n\n", title)
+		if len(section.rows) == 0 {
+			fmt.Fprint(w, "No questions.\n")
+			continue
+		}
+		fmt.Fprint(w, "| Votes | State | Question | Created |\n| ---: | --- | --- | --- |\n")
+		for _, r := range section.rows {
+			if _, err := fmt.Fprintf(w, "| %d | %s | %s | %s |\n", r.Vote, r.State, markdownEscaper.Replace(r.Question), r.created()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
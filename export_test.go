@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportQuestions(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := gin.New()
+	router.GET("/export/:eventtoken", organizer("ann@example.com"), getEventExport)
+	router.GET("/export/:eventtoken/:session", organizer("ann@example.com"), getSessionExport)
+
+	event := &Event{Name: "Open Zlin", CreatedBy: "ann@example.com", Sessions: []Session{{Name: "Intro", Room: "A"}, {Name: "Keynote", Room: "@B"}}}
+	storage.InsertEvent(event)
+	intro := event.Sessions[0].SessionToken
+	keynote := event.Sessions[1].SessionToken
+	first := &Question{EventToken: event.EventToken, SessionToken: intro, Question: "Tabs | spaces?"}
+	second := &Question{EventToken: event.EventToken, SessionToken: intro, Question: "Does it scale, really?"}
+	third := &Question{EventToken: event.EventToken, SessionToken: keynote, Question: "=HYPERLINK(\"http://a.cz\")"}
+	for _, q := range []*Question{first, second, third} {
+		createQuestion(q)
+	}
+	castVote(second.ID.Hex(), "client1", OperationUpvote)
+	changeQuestionState(third.ID.Hex(), StateAnswered)
+
+	export := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := export("/export/" + event.EventToken)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("CSV not exported %d", w.Code)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[1][3] != "Does it scale, really?" || records[1][4] != "1" || records[1][1] != "Intro" {
+		t.Errorf("Unexpected CSV %v", records)
+	}
+	if records[3][2] != "'@B" || records[3][3] != `'=HYPERLINK("http://a.cz")` || records[3][5] != StateAnswered {
+		t.Errorf("Unexpected CSV row %v", records[3])
+	}
+
+	w = export("/export/" + event.EventToken + "?format=jsonl&state=answered")
+	rows := make([]ExportRow, 0)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		row := ExportRow{}
+		json.Unmarshal(scanner.Bytes(), &row)
+		rows = append(rows, row)
+	}
+	if len(rows) != 1 || rows[0].SessionName != "Keynote" || rows[0].EventName != "Open Zlin" {
+		t.Errorf("Unexpected JSON lines %v", rows)
+	}
+
+	w = export("/export/" + event.EventToken + "/" + intro + "?format=md")
+	body := w.Body.String()
+	if !strings.Contains(body, "## Intro (A)") || !strings.Contains(body, `Tabs \| spaces?`) || strings.Contains(body, "Keynote") {
+		t.Errorf("Unexpected markdown %s", body)
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), event.EventToken+"-"+intro+".md") {
+		t.Errorf("Unexpected disposition %s", w.Header().Get("Content-Disposition"))
+	}
+
+	if w = export("/export/" + event.EventToken + "?format=pdf"); w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown format exported %d", w.Code)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Content policies of event applied
+// to the question violating filters
+const (
+	ContentReject   = "reject"
+	ContentMask     = "mask"
+	ContentModerate = "moderate"
+)
+
+// maskRune replaces the
+// characters of masked words
+const maskRune = '*'
+
+// Violation describes the part
+// of text refused by filter
+type Violation struct {
+	Filter string `json:"filter"`
+	Reason string `json:"reason"`
+	Match  string `json:"match,omitempty"`
+}
+
+// ContentError is returned for question
+// refused by the content filters
+type ContentError struct {
+	Violations []Violation
+}
+
+func (e *ContentError) Error() string {
+	return "question: content refused by filters"
+}
+
+// ContentRejection is the response
+// to the refused question
+type ContentRejection struct {
+	Message    string      `json:"message"`
+	Violations []Violation `json:"violations"`
+}
+
+// ContentFilter checks the question text in
+// the language, the empty language means any.
+// The returned text has the violating parts
+// masked.
+type ContentFilter interface {
+	Check(text, language string) (string, []Violation)
+}
+
+// FilterPipeline runs the filters
+// in order over the masked text
+type FilterPipeline []ContentFilter
+
+func (p FilterPipeline) Check(text, language string) (string, []Violation) {
+	violations := make([]Violation, 0)
+	for _, filter := range p {
+		masked, found := filter.Check(text, language)
+		text = masked
+		violations = append(violations, found...)
+	}
+	return text, violations
+}
+
+// NewFilterPipeline creates the
+// built-in filters of configuration
+func NewFilterPipeline(cfg *FilterConfig, words map[string][]string) FilterPipeline {
+	return FilterPipeline{
+		NewWordFilter(words),
+		&LinkFilter{cfg.MaxLinks},
+		&RepeatFilter{cfg.MaxRepeat},
+		&CapsFilter{cfg.CapsRatio, cfg.CapsMinLetters},
+	}
+}
+
+// defaultWords is the built-in word
+// list of the supported languages
+var defaultWords = map[string][]string{
+	"en": {"fuck", "fucking", "shit", "bitch", "asshole", "bastard", "cunt", "dick"},
+	"cs": {"kurva", "píča", "hovno", "debil", "kretén", "zmrd", "čurák", "prdel"},
+}
+
+// LoadWordList reads the word list file with
+// lines of language and word separated by
+// space and adds them to the built-in list
+func LoadWordList(path string) (map[string][]string, error) {
+	words := make(map[string][]string)
+	for lang, list := range defaultWords {
+		words[lang] = append([]string(nil), list...)
+	}
+	if len(path) == 0 {
+		return words, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		words[fields[0]] = append(words[fields[0]], strings.ToLower(fields[1]))
+	}
+	return words, scanner.Err()
+}
+
+// WordFilter masks the listed
+// words of the language
+type WordFilter struct {
+	words map[string]map[string]bool
+}
+
+func NewWordFilter(words map[string][]string) *WordFilter {
+	f := &WordFilter{make(map[string]map[string]bool)}
+	for lang, list := range words {
+		f.words[lang] = make(map[string]bool)
+		for _, word := range list {
+			f.words[lang][word] = true
+		}
+	}
+	return f
+}
+
+func (f *WordFilter) listed(word, language string) bool {
+	if len(language) > 0 {
+		return f.words[language][word]
+	}
+	for _, words := range f.words {
+		if words[word] {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *WordFilter) Check(text, language string) (string, []Violation) {
+	violations := make([]Violation, 0)
+	runes := []rune(text)
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsNumber(runes[i])) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			word := string(runes[start:i])
+			if f.listed(strings.ToLower(word), language) {
+				violations = append(violations, Violation{"words", "word not allowed", word})
+				for j := start; j < i; j++ {
+					runes[j] = maskRune
+				}
+			}
+			start = -1
+		}
+	}
+	return string(runes), violations
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkFilter limits the number of
+// links, the links over limit are masked
+type LinkFilter struct {
+	max int
+}
+
+func (f *LinkFilter) Check(text, language string) (string, []Violation) {
+	violations := make([]Violation, 0)
+	count := 0
+	masked := linkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		count++
+		if count <= f.max {
+			return link
+		}
+		violations = append(violations, Violation{"links", "too many links", link})
+		return "[link]"
+	})
+	return masked, violations
+}
+
+// RepeatFilter limits the runs of
+// the same letter or punctuation, the
+// longer runs are shortened. Digits,
+// spaces and masked words are left
+// untouched.
+type RepeatFilter struct {
+	max int
+}
+
+func (f *RepeatFilter) Check(text, language string) (string, []Violation) {
+	violations := make([]Violation, 0)
+	result := make([]rune, 0)
+	run := 0
+	var last rune
+	for i, r := range []rune(text) {
+		if i > 0 && r == last {
+			run++
+		} else {
+			run = 1
+		}
+		last = r
+		if run > f.max && r != maskRune && (unicode.IsLetter(r) || unicode.IsPunct(r)) {
+			if run == f.max+1 {
+				violations = append(violations, Violation{"repeat", "repeated characters", strings.Repeat(string(r), f.max+1)})
+			}
+			continue
+		}
+		result = append(result, r)
+	}
+	return string(result), violations
+}
+
+// CapsFilter refuses the text written
+// mostly in capitals, the text is
+// masked to lower case
+type CapsFilter struct {
+	ratio      float64
+	minLetters int
+}
+
+func (f *CapsFilter) Check(text, language string) (string, []Violation) {
+	letters, upper := 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters < f.minLetters || float64(upper)/float64(letters) <= f.ratio {
+		return text, []Violation{}
+	}
+	return strings.ToLower(text), []Violation{{"caps", "text in capitals", ""}}
+}
+
+// filterQuestion runs the content filters over
+// question by the policy of event. The masked text
+// replaces the question, the flagged question is
+// sent to moderation, otherwise ContentError
+// is returned.
+func filterQuestion(question *Question, event *Event) (bool, error) {
+	if contentFilter == nil {
+		return false, nil
+	}
+	masked, violations := contentFilter.Check(question.Question, event.Language)
+	if len(violations) == 0 {
+		return false, nil
+	}
+	policy := event.ContentPolicy
+	if len(policy) == 0 {
+		policy = filterCfg.Policy
+	}
+	switch policy {
+	case ContentMask:
+		question.Question = masked
+		return false, nil
+	case ContentModerate:
+		question.Flags = violations
+		return true, nil
+	}
+	return false, &ContentError{violations}
+}
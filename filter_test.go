@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestContentFilters(t *testing.T) {
+	pipeline := NewFilterPipeline(filterCfg, defaultWords)
+
+	cases := []struct {
+		text     string
+		language string
+		masked   string
+		filters  []string
+	}{
+		{"What is new in Go?", "", "What is new in Go?", nil},
+		{"What the Fuck is Go?", "", "What the **** is Go?", []string{"words"}},
+		{"Je to kurva dobré?", "en", "Je to kurva dobré?", nil},
+		{"Je to kurva dobré?", "cs", "Je to ***** dobré?", []string{"words"}},
+		{"See http://a.cz and www.b.cz", "", "See http://a.cz and [link]", []string{"links"}},
+		{"Whyyyyyyy???", "", "Whyyyy???", []string{"repeat"}},
+		{"Can it handle 1000000 requests?", "", "Can it handle 1000000 requests?", nil},
+		{"WHY IS THIS SO SLOW TODAY?", "", "why is this so slow today?", []string{"caps"}},
+		{"Is AWS OK?", "", "Is AWS OK?", nil},
+	}
+	for _, c := range cases {
+		masked, violations := pipeline.Check(c.text, c.language)
+		if masked != c.masked || len(violations) != len(c.filters) {
+			t.Errorf("Unexpected result %q %v of %q", masked, violations, c.text)
+			continue
+		}
+		for i, filter := range c.filters {
+			if violations[i].Filter != filter {
+				t.Errorf("Unexpected violation %v of %q", violations[i], c.text)
+			}
+		}
+	}
+}
+
+func TestLoadWordList(t *testing.T) {
+	file, _ := ioutil.TempFile("", "words")
+	defer os.Remove(file.Name())
+	file.WriteString("# custom words\nen spam\nde scheisse\n")
+	file.Close()
+
+	words, err := LoadWordList(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := NewWordFilter(words)
+	if !filter.listed("spam", "en") || !filter.listed("scheisse", "de") || !filter.listed("fuck", "en") {
+		t.Errorf("Unexpected word list %v", words)
+	}
+}
+
+func TestContentPolicy(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	rejecting := &Event{Name: "Reject", Sessions: []Session{{Name: "Intro"}}}
+	masking := &Event{Name: "Mask", ContentPolicy: ContentMask, Sessions: []Session{{Name: "Intro"}}}
+	moderating := &Event{Name: "Moderate", ContentPolicy: ContentModerate, Sessions: []Session{{Name: "Intro"}}}
+	for _, e := range []*Event{rejecting, masking, moderating} {
+		storage.InsertEvent(e)
+	}
+
+	body, _ := json.Marshal(&Question{
+		EventToken:   rejecting.EventToken,
+		SessionToken: rejecting.Sessions[0].SessionToken,
+		Question:     "Why is it shit?",
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/question", bytes.NewReader(body))
+	router.ServeHTTP(w, req)
+	rejection := &ContentRejection{}
+	json.Unmarshal(w.Body.Bytes(), rejection)
+	if w.Code != http.StatusBadRequest || len(rejection.Violations) != 1 || rejection.Violations[0].Match != "shit" {
+		t.Errorf("Question not rejected %d %v", w.Code, rejection)
+	}
+
+	masked := &Question{EventToken: masking.EventToken, SessionToken: masking.Sessions[0].SessionToken, Question: "Why is it shit?"}
+	if err := createQuestion(masked); err != nil {
+		t.Fatal(err)
+	}
+	if masked.Question != "Why is it ****?" || !masked.Visible() {
+		t.Errorf("Question not masked %v", masked)
+	}
+
+	flagged := &Question{EventToken: moderating.EventToken, SessionToken: moderating.Sessions[0].SessionToken, Question: "Why is it shit?"}
+	if err := createQuestion(flagged); err != nil {
+		t.Fatal(err)
+	}
+	pending, _ := storage.PendingQuestions(moderating.EventToken)
+	if flagged.Moderation != ModerationPending || len(pending) != 1 || len(pending[0].Flags) != 1 {
+		t.Errorf("Question not sent to moderation %v", pending)
+	}
+
+	edited := &Question{EventToken: moderating.EventToken, SessionToken: moderating.Sessions[0].SessionToken, Question: "Why is it good?"}
+	if err := createQuestion(edited); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := changeQuestionText(edited.ID.Hex(), edited.AuthorSecret, "Why is it shit?"); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := storage.QuestionById(edited.ID.Hex())
+	if stored.Moderation != ModerationPending || len(stored.Flags) != 1 || stored.Question != "Why is it shit?" {
+		t.Errorf("Flagged edit not stored for moderation %v", stored)
+	}
+}
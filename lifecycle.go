@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// StateChange is the body of
+// the question state request
+type StateChange struct {
+	State string `json:"state"`
+}
+
+func putQuestionState(c *gin.Context) {
+	change := &StateChange{}
+	if err := c.BindJSON(change); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the state")
+		return
+	}
+	if ownedQuestion(c, c.Params.ByName("questionID")) == nil {
+		return
+	}
+	q, err := changeQuestionState(c.Params.ByName("questionID"), change.State)
+	if err == mgo.ErrNotFound {
+		log.Errorln(err)
+		c.JSON(http.StatusNotFound, "Question not exist")
+		return
+	}
+	if _, ok := err.(*ValidationError); ok {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot change the state")
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+// changeQuestionState stores the lifecycle
+// state and notifies the session subscribers
+func changeQuestionState(questionID, state string) (*Question, error) {
+	if !ValidState(state) {
+		return nil, ErrStateInvalid
+	}
+	if !bson.IsObjectIdHex(questionID) {
+		return nil, mgo.ErrNotFound
+	}
+	q, err := mongo.QuestionById(questionID)
+	if err != nil {
+		return nil, err
+	}
+	if !q.Visible() {
+		return nil, mgo.ErrNotFound
+	}
+	if err := mongo.SetQuestionState(questionID, state); err != nil {
+		return nil, err
+	}
+	q.State = state
+	updateErr := notifyChange(q.EventToken, q.SessionToken, MsgQuestionState, &QuestionStateRef{q.ID, state})
+	if updateErr != nil {
+		log.Errorln(updateErr)
+	}
+	return q, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQuestionLifecycle(t *testing.T) {
+	storage := setupMemoryBackend()
+	manager := commMan.(*MapEventManager)
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	ids := make([]string, 0)
+	for _, text := range []string{"first", "second", "third"} {
+		q := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: text}
+		if err := createQuestion(q); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, q.ID.Hex())
+	}
+	client := addIdleClient(manager, event.EventToken, sessionToken)
+
+	if _, err := changeQuestionState(ids[0], "solved"); err != ErrStateInvalid {
+		t.Error("Unknown state accepted")
+	}
+	if _, err := changeQuestionState(ids[0], StateAnswered); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := changeQuestionState(ids[1], StatePinned); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.queue) != 2 {
+		t.Fatal("State change not broadcast")
+	}
+	msg := &Message{}
+	json.Unmarshal(<-client.queue, msg)
+	data, _ := msg.Data.(map[string]interface{})
+	if msg.Type != MsgQuestionState || data["id"] != ids[0] || data["state"] != StateAnswered {
+		t.Errorf("Unexpected message %v", msg)
+	}
+
+	open, _ := storage.QuestionsByEventAndSession(event.EventToken, sessionToken, StateOpen, StatePinned)
+	if len(open) != 2 || open[0].Question != "second" || open[1].Question != "third" {
+		t.Errorf("Unexpected open questions %v", open)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/questions/"+event.EventToken+"/"+sessionToken+"?state=answered", nil)
+	router.ServeHTTP(w, req)
+	page := &QuestionPage{}
+	json.Unmarshal(w.Body.Bytes(), page)
+	answered := page.Questions
+	if w.Code != http.StatusOK || len(answered) != 1 || answered[0].Question != "first" {
+		t.Errorf("Unexpected answered questions %d %v", w.Code, answered)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/questions/"+event.EventToken+"/"+sessionToken+"?state=done", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown state filter accepted %d", w.Code)
+	}
+}
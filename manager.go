@@ -1,19 +1,80 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+var ErrConnectionNotFound = errors.New("manager: connection not registered")
+
+// SlowConsumerPolicy decides what happens
+// with message for connection which
+// outbound queue is full
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDropOldest drops the oldest
+	// queued message of connection
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyCoalesce drops all queued messages
+	// of connection and keeps the newest one
+	PolicyCoalesce SlowConsumerPolicy = "coalesce"
+	// PolicyDisconnect closes the connection
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+)
+
 type EventManager interface {
-	RegisterConnection(eventToken, sessionToken string, conn *websocket.Conn)
+	// RegisterConnection subscribes the websocket
+	// connection to the event session, the queued
+	// messages are written to the connection
+	// until it is removed.
+	RegisterConnection(eventToken, sessionToken string, conn *websocket.Conn) *Subscription
 	RemoveConnection(eventToken, sessionToken string, conn *websocket.Conn)
 	GetConnByEventSession(eventToken, sessionToken string) []*websocket.Conn
+	// Subscribe creates the subscription to event
+	// session, the caller is responsible for
+	// reading its messages and unsubscribing.
+	Subscribe(eventToken, sessionToken string) *Subscription
+	// Resume creates the subscription with queued
+	// messages broadcasted after the since sequence
+	// of stream. The false is returned if the
+	// messages are no longer buffered, the client
+	// then needs the snapshot.
+	Resume(eventToken, sessionToken, stream string, since uint64) (*Subscription, bool)
+	// AttachConnection writes the messages
+	// of subscription to websocket connection
+	AttachConnection(sub *Subscription, conn *websocket.Conn)
+	Unsubscribe(sub *Subscription)
+	// Send queues the object
+	// for single subscription
+	Send(sub *Subscription, object interface{}) error
+	// Seq returns the sequence number of
+	// last message broadcasted to session
+	Seq(eventToken, sessionToken string) uint64
+	// Stream identifies the sequences of
+	// manager, the sequences of other
+	// manager cannot be resumed
+	Stream() string
+	// SendJsonByEventAndSessionToken queues the
+	// object for session subscriptions without
+	// assigning the sequence number
+	SendJsonByEventAndSessionToken(eventToken, sessionToken string, object interface{}) []error
+	// Audiences returns the number of
+	// subscriptions of each session, the
+	// moderator feeds are not the audience
+	Audiences() []SessionAudience
 }
 
 type Notifier interface {
-	SendJsonByEventAndSessionToken(eventToken, sessionToken string, object interface{}) []error
+	// Broadcast assigns the next session
+	// sequence number to message and
+	// sends it to the session connections
+	Broadcast(msg *Message) []error
 }
 
 type eventConn struct {
@@ -21,26 +82,84 @@ type eventConn struct {
 	conn        *websocket.Conn
 }
 
+// Subscription is the outbound queue of
+// single subscriber of event session. The
+// Done channel is closed when the subscription
+// is removed from manager.
+type Subscription struct {
+	EventToken   string
+	SessionToken string
+	// Client identifies the attendee
+	// client of subscription if known
+	Client string
+	// Addr is the address of client
+	Addr string
+	// Sort is the ordering mode
+	// of the session snapshots
+	Sort string
+	// conn is set for
+	// websocket subscriptions
+	conn  *websocket.Conn
+	queue chan []byte
+	done  chan struct{}
+}
+
+func (s *Subscription) Messages() <-chan []byte {
+	return s.queue
+}
+
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// ManagerStats are the counters
+// of MapEventManager
+type ManagerStats struct {
+	Connections  int    `json:"connections"`
+	Dropped      uint64 `json:"dropped"`
+	Disconnected uint64 `json:"disconnected"`
+}
+
+// replayEntry is the broadcasted
+// message kept for resume
+type replayEntry struct {
+	seq  uint64
+	data []byte
+}
+
 type MapEventManager struct {
 	*sync.Mutex
-	connMap map[string]map[*websocket.Conn]bool
+	stream       string
+	connMap      map[string]map[*Subscription]bool
+	conns        map[*websocket.Conn]*Subscription
+	seqMap       map[string]uint64
+	replayMap    map[string][]replayEntry
+	cfg          WsConfig
+	dropped      uint64
+	disconnected uint64
 }
 
-func (m *MapEventManager) RegisterConnection(eventToken, sessionToken string, conn *websocket.Conn) {
-	mergedToken := mergeToken(eventToken, sessionToken)
+func (m *MapEventManager) RegisterConnection(eventToken, sessionToken string, conn *websocket.Conn) *Subscription {
+	sub := m.Subscribe(eventToken, sessionToken)
+	m.AttachConnection(sub, conn)
+	return sub
+}
+
+func (m *MapEventManager) AttachConnection(sub *Subscription, conn *websocket.Conn) {
 	m.Lock()
-	if m.connMap[mergedToken] == nil {
-		m.connMap[mergedToken] = make(map[*websocket.Conn]bool)
+	if old := m.conns[conn]; old != nil {
+		m.remove(old)
 	}
-	m.connMap[mergedToken][conn] = true
+	sub.conn = conn
+	m.conns[conn] = sub
 	m.Unlock()
+	go writePump(sub, m.cfg)
 }
 
 func (m *MapEventManager) RemoveConnection(eventToken, sessionToken string, conn *websocket.Conn) {
-	mergedToken := mergeToken(eventToken, sessionToken)
 	m.Lock()
-	if m.connMap[mergedToken] != nil {
-		delete(m.connMap[mergedToken], conn)
+	if sub := m.conns[conn]; sub != nil {
+		m.remove(sub)
 	}
 	m.Unlock()
 }
@@ -49,37 +168,284 @@ func (m *MapEventManager) GetConnByEventSession(eventToken, sessionToken string)
 	mergedToken := mergeToken(eventToken, sessionToken)
 	keys := make([]*websocket.Conn, 0)
 	m.Lock()
-	if m.connMap[mergedToken] != nil {
-		for k := range m.connMap[mergedToken] {
-			keys = append(keys, k)
+	for sub := range m.connMap[mergedToken] {
+		if sub.conn != nil {
+			keys = append(keys, sub.conn)
 		}
 	}
 	m.Unlock()
 	return keys
 }
 
+func (m *MapEventManager) Subscribe(eventToken, sessionToken string) *Subscription {
+	m.Lock()
+	defer m.Unlock()
+	return m.subscribe(eventToken, sessionToken, 0)
+}
+
+func (m *MapEventManager) Resume(eventToken, sessionToken, stream string, since uint64) (*Subscription, bool) {
+	mergedToken := mergeToken(eventToken, sessionToken)
+	m.Lock()
+	defer m.Unlock()
+	seq := m.seqMap[mergedToken]
+	buffer := m.replayMap[mergedToken]
+	missed := make([]replayEntry, 0)
+	resumable := stream == m.stream && since <= seq
+	if resumable && since < seq {
+		resumable = len(buffer) > 0 && buffer[0].seq <= since+1
+		for _, entry := range buffer {
+			if entry.seq > since {
+				missed = append(missed, entry)
+			}
+		}
+	}
+	if !resumable {
+		return m.subscribe(eventToken, sessionToken, 0), false
+	}
+	// The queue is enlarged so all the
+	// missed messages fit into it
+	sub := m.subscribe(eventToken, sessionToken, len(missed))
+	for _, entry := range missed {
+		sub.queue <- entry.data
+	}
+	return sub, true
+}
+
+func (m *MapEventManager) Unsubscribe(sub *Subscription) {
+	m.Lock()
+	m.remove(sub)
+	m.Unlock()
+}
+
+// subscribe adds new subscription with the
+// queue enlarged by extra messages, the
+// caller must hold the lock
+func (m *MapEventManager) subscribe(eventToken, sessionToken string, extra int) *Subscription {
+	sub := &Subscription{
+		EventToken:   eventToken,
+		SessionToken: sessionToken,
+		queue:        make(chan []byte, m.cfg.QueueSize+extra),
+		done:         make(chan struct{}),
+	}
+	mergedToken := mergeToken(eventToken, sessionToken)
+	if m.connMap[mergedToken] == nil {
+		m.connMap[mergedToken] = make(map[*Subscription]bool)
+	}
+	m.connMap[mergedToken][sub] = true
+	return sub
+}
+
+// remove removes the subscription and
+// closes its done channel, the caller
+// must hold the lock
+func (m *MapEventManager) remove(sub *Subscription) {
+	mergedToken := mergeToken(sub.EventToken, sub.SessionToken)
+	if !m.connMap[mergedToken][sub] {
+		return
+	}
+	close(sub.done)
+	delete(m.connMap[mergedToken], sub)
+	if sub.conn != nil {
+		delete(m.conns, sub.conn)
+	}
+}
+
+// SendJsonByEventAndSessionToken queues the object
+// for all connections of event session. The
+// call does not wait for the object to be written.
 func (m *MapEventManager) SendJsonByEventAndSessionToken(eventToken, sessionToken string, object interface{}) []error {
-	errors := make([]error, 0)
-	connections := m.GetConnByEventSession(eventToken, sessionToken)
+	errs := make([]error, 0)
+	data, err := json.Marshal(object)
+	if err != nil {
+		return append(errs, err)
+	}
+	mergedToken := mergeToken(eventToken, sessionToken)
+	m.Lock()
+	m.enqueueAll(mergedToken, data)
+	m.Unlock()
+	return errs
+}
+
+func (m *MapEventManager) Broadcast(msg *Message) []error {
+	mergedToken := mergeToken(msg.EventToken, msg.SessionToken)
+	// The lock is held while marshalling so
+	// the messages are queued in sequence order
+	m.Lock()
+	defer m.Unlock()
+	m.seqMap[mergedToken]++
+	msg.Seq = m.seqMap[mergedToken]
+	msg.Stream = m.stream
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return []error{err}
+	}
+	buffer := append(m.replayMap[mergedToken], replayEntry{msg.Seq, data})
+	if len(buffer) > m.cfg.ReplaySize {
+		buffer = buffer[len(buffer)-m.cfg.ReplaySize:]
+	}
+	m.replayMap[mergedToken] = buffer
+	m.enqueueAll(mergedToken, data)
+	return []error{}
+}
+
+func (m *MapEventManager) Send(sub *Subscription, object interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
 	m.Lock()
-	for _, conn := range connections {
-		err := conn.WriteJSON(object)
-		if err != nil {
-			errors = append(errors, err)
+	defer m.Unlock()
+	if !m.connMap[mergeToken(sub.EventToken, sub.SessionToken)][sub] {
+		return ErrConnectionNotFound
+	}
+	m.enqueue(sub, data)
+	return nil
+}
+
+func (m *MapEventManager) Seq(eventToken, sessionToken string) uint64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.seqMap[mergeToken(eventToken, sessionToken)]
+}
+
+func (m *MapEventManager) Stream() string {
+	return m.stream
+}
+
+// enqueueAll puts data into the queues
+// of all session subscriptions, the caller
+// must hold the lock
+func (m *MapEventManager) enqueueAll(mergedToken string, data []byte) {
+	for sub := range m.connMap[mergedToken] {
+		m.enqueue(sub, data)
+	}
+}
+
+// enqueue puts data into the queue of subscription,
+// the slow consumer policy is applied if the
+// queue is full. The caller must hold the lock.
+func (m *MapEventManager) enqueue(sub *Subscription, data []byte) {
+	select {
+	case sub.queue <- data:
+		return
+	default:
+	}
+	switch m.cfg.SlowConsumer {
+	case PolicyDisconnect:
+		log.Infof("enqueue: disconnecting slow consumer of %s/%s", sub.EventToken, sub.SessionToken)
+		atomic.AddUint64(&m.disconnected, 1)
+		m.remove(sub)
+		if sub.conn != nil {
+			sub.conn.Close()
+		}
+		return
+	case PolicyCoalesce:
+		for m.drop(sub) {
+		}
+	default:
+		m.drop(sub)
+	}
+	// The readers drain the queue without
+	// the lock, so neither the drop nor the
+	// retried send may block
+	select {
+	case sub.queue <- data:
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+	}
+}
+
+// drop removes the oldest message from
+// the queue of subscription if any
+func (m *MapEventManager) drop(sub *Subscription) bool {
+	select {
+	case <-sub.queue:
+		atomic.AddUint64(&m.dropped, 1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *MapEventManager) Audiences() []SessionAudience {
+	audiences := make([]SessionAudience, 0)
+	m.Lock()
+	for _, subs := range m.connMap {
+		for sub := range subs {
+			if sub.SessionToken == ModerationSession {
+				break
+			}
+			audiences = append(audiences, SessionAudience{
+				EventToken:   sub.EventToken,
+				SessionToken: sub.SessionToken,
+				Count:        len(subs),
+			})
+			break
 		}
 	}
 	m.Unlock()
-	return errors
+	return audiences
 }
 
-func NewEventManager() *MapEventManager {
-	return newMapEventManager()
+// Stats returns the current
+// counters of manager
+func (m *MapEventManager) Stats() ManagerStats {
+	stats := ManagerStats{
+		Dropped:      atomic.LoadUint64(&m.dropped),
+		Disconnected: atomic.LoadUint64(&m.disconnected),
+	}
+	m.Lock()
+	for _, subs := range m.connMap {
+		stats.Connections += len(subs)
+	}
+	m.Unlock()
+	return stats
 }
 
-func newMapEventManager() *MapEventManager {
+// writePump writes queued messages and pings
+// to the connection until the subscription is
+// removed from manager. The connection is closed
+// if the write fails so the readPump ends too.
+func writePump(sub *Subscription, cfg WsConfig) {
+	ticker := time.NewTicker(cfg.PingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case data := <-sub.queue:
+			sub.conn.SetWriteDeadline(time.Now().Add(cfg.WriteWait))
+			if err := sub.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Errorf("writePump: cannot write message %v", err)
+				sub.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(cfg.WriteWait)
+			if err := sub.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				sub.conn.Close()
+				return
+			}
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+func NewEventManager(cfg *WsConfig) *MapEventManager {
+	return newMapEventManager(*cfg)
+}
+
+func newMapEventManager(cfg WsConfig) *MapEventManager {
+	if cfg.QueueSize < 1 {
+		cfg.QueueSize = 1
+	}
 	manager := &MapEventManager{
-		&sync.Mutex{},
-		make(map[string]map[*websocket.Conn]bool),
+		Mutex:     &sync.Mutex{},
+		stream:    generateToken(8),
+		connMap:   make(map[string]map[*Subscription]bool),
+		conns:     make(map[*websocket.Conn]*Subscription),
+		seqMap:    make(map[string]uint64),
+		replayMap: make(map[string][]replayEntry),
+		cfg:       cfg,
 	}
 	return manager
 }
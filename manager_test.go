@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -12,7 +15,7 @@ func TestMapManager(t *testing.T) {
 	sessionId := "1234"
 	mergedToken := mergeToken(eventId, sessionId)
 	conn := &websocket.Conn{}
-	manager := newMapEventManager()
+	manager := newMapEventManager(*wsCfg)
 	manager.RegisterConnection(eventId, sessionId, conn)
 
 	if len(manager.connMap) == 0 {
@@ -31,3 +34,133 @@ func TestMapManager(t *testing.T) {
 	}
 
 }
+
+// addIdleClient subscribes to the session
+// without any reader of the queue
+func addIdleClient(manager *MapEventManager, eventToken, sessionToken string) *Subscription {
+	return manager.Subscribe(eventToken, sessionToken)
+}
+
+func TestSlowConsumerDropOldest(t *testing.T) {
+	cfg := *wsCfg
+	cfg.QueueSize = 2
+	cfg.SlowConsumer = PolicyDropOldest
+	manager := newMapEventManager(cfg)
+	client := addIdleClient(manager, "abcd", "1234")
+
+	for i := 1; i <= 3; i++ {
+		manager.SendJsonByEventAndSessionToken("abcd", "1234", i)
+	}
+
+	if first := string(<-client.queue); first != "2" {
+		t.Errorf("oldest message not dropped, got %s", first)
+	}
+	if manager.Stats().Dropped != 1 {
+		t.Error("dropped message not counted")
+	}
+}
+
+func TestSlowConsumerCoalesce(t *testing.T) {
+	cfg := *wsCfg
+	cfg.QueueSize = 2
+	cfg.SlowConsumer = PolicyCoalesce
+	manager := newMapEventManager(cfg)
+	client := addIdleClient(manager, "abcd", "1234")
+
+	for i := 1; i <= 3; i++ {
+		manager.SendJsonByEventAndSessionToken("abcd", "1234", i)
+	}
+
+	if len(client.queue) != 1 || string(<-client.queue) != "3" {
+		t.Error("queue not coalesced to newest message")
+	}
+	if manager.Stats().Dropped != 2 {
+		t.Error("dropped messages not counted")
+	}
+}
+
+func TestSlowConsumerConcurrentReader(t *testing.T) {
+	// The reader must run in parallel
+	// to drain between send and drop
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	for _, policy := range []SlowConsumerPolicy{PolicyDropOldest, PolicyCoalesce} {
+		cfg := *wsCfg
+		cfg.QueueSize = 1
+		cfg.SlowConsumer = policy
+		manager := newMapEventManager(cfg)
+		client := addIdleClient(manager, "abcd", "1234")
+
+		// The reader drains the queue without
+		// the lock, as writePump does
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-client.queue:
+				case <-done:
+					return
+				}
+				runtime.Gosched()
+			}
+		}()
+		sent := make(chan struct{})
+		go func() {
+			for i := 0; i < 10000; i++ {
+				manager.SendJsonByEventAndSessionToken("abcd", "1234", i)
+			}
+			close(sent)
+		}()
+		select {
+		case <-sent:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("manager blocked with %s policy", policy)
+		}
+		close(done)
+	}
+}
+
+func TestBroadcastSequence(t *testing.T) {
+	manager := newMapEventManager(*wsCfg)
+	client := addIdleClient(manager, "abcd", "1234")
+
+	manager.Broadcast(&Message{Type: MsgQuestionAdded, EventToken: "abcd", SessionToken: "1234"})
+	manager.Broadcast(&Message{Type: MsgQuestionVoted, EventToken: "abcd", SessionToken: "1234"})
+	manager.Broadcast(&Message{Type: MsgQuestionAdded, EventToken: "abcd", SessionToken: "5678"})
+
+	if manager.Seq("abcd", "1234") != 2 || manager.Seq("abcd", "5678") != 1 {
+		t.Error("Sequence not increased per session")
+	}
+	if len(client.queue) != 2 {
+		t.Error("Messages not queued for session")
+	}
+}
+
+func TestResumeFromSequence(t *testing.T) {
+	cfg := *wsCfg
+	cfg.ReplaySize = 3
+	manager := newMapEventManager(cfg)
+	for i := 0; i < 5; i++ {
+		manager.Broadcast(&Message{Type: MsgQuestionAdded, EventToken: "abcd", SessionToken: "1234"})
+	}
+	stream := manager.Stream()
+
+	sub, ok := manager.Resume("abcd", "1234", stream, 3)
+	if !ok || len(sub.queue) != 2 {
+		t.Error("Missed messages not replayed")
+	}
+	msg := &Message{}
+	json.Unmarshal(<-sub.queue, msg)
+	if msg.Seq != 4 {
+		t.Errorf("Replay not started after last sequence %d", msg.Seq)
+	}
+
+	if sub, ok := manager.Resume("abcd", "1234", stream, 5); !ok || len(sub.queue) != 0 {
+		t.Error("Up to date client should resume without messages")
+	}
+	if _, ok := manager.Resume("abcd", "1234", stream, 1); ok {
+		t.Error("Resume beyond replay buffer should require snapshot")
+	}
+	if _, ok := manager.Resume("abcd", "1234", "other", 4); ok {
+		t.Error("Resume of other stream should require snapshot")
+	}
+}
@@ -0,0 +1,823 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MemoryDataStorage is DataStorage
+// implementation that keeps all the
+// data in process memory. It is meant
+// for tests and local development.
+type MemoryDataStorage struct {
+	*sync.RWMutex
+	events      map[bson.ObjectId]*Event
+	questions   map[bson.ObjectId]*Question
+	speakers    map[bson.ObjectId]*Speaker
+	votes       []Vote
+	polls       map[bson.ObjectId]*Poll
+	ballots     []Ballot
+	pollOrder   []bson.ObjectId
+	prompts     map[bson.ObjectId]*Prompt
+	responses   []PromptResponse
+	promptOrder []bson.ObjectId
+	ratings     []Rating
+	peaks       map[string]*SessionPeak
+	// questionOrder keeps the insertion
+	// order of questions, the same order
+	// mongo returns them in
+	questionOrder []bson.ObjectId
+}
+
+func NewMemoryStorage() *MemoryDataStorage {
+	return &MemoryDataStorage{
+		RWMutex:   &sync.RWMutex{},
+		events:    make(map[bson.ObjectId]*Event),
+		questions: make(map[bson.ObjectId]*Question),
+		speakers:  make(map[bson.ObjectId]*Speaker),
+		polls:     make(map[bson.ObjectId]*Poll),
+		prompts:   make(map[bson.ObjectId]*Prompt),
+		peaks:     make(map[string]*SessionPeak),
+	}
+}
+
+func (m *MemoryDataStorage) OpenSession() error {
+	return nil
+}
+
+func (m *MemoryDataStorage) CloseSession() {
+}
+
+func (m *MemoryDataStorage) InsertSpeaker(s *Speaker) error {
+	s.ID = bson.NewObjectId()
+	m.Lock()
+	m.speakers[s.ID] = copySpeaker(s)
+	m.Unlock()
+	return nil
+}
+
+func (m *MemoryDataStorage) UpdateSpeaker(s *Speaker) error {
+	m.Lock()
+	m.speakers[s.ID] = copySpeaker(s)
+	m.Unlock()
+	return nil
+}
+
+func (m *MemoryDataStorage) SpeakerById(hexId string) (*Speaker, error) {
+	if !bson.IsObjectIdHex(hexId) {
+		return nil, mgo.ErrNotFound
+	}
+	m.RLock()
+	defer m.RUnlock()
+	s, ok := m.speakers[bson.ObjectIdHex(hexId)]
+	if !ok {
+		return nil, mgo.ErrNotFound
+	}
+	return copySpeaker(s), nil
+}
+
+func (m *MemoryDataStorage) SpeakersById(hexIds []string) ([]*Speaker, error) {
+	speakers := make([]*Speaker, 0)
+	for _, id := range hexIds {
+		s, err := m.SpeakerById(id)
+		if err != nil {
+			return speakers, err
+		}
+		speakers = append(speakers, s)
+	}
+	return speakers, nil
+}
+
+func (m *MemoryDataStorage) InsertEvent(event *Event) error {
+	event.ID = bson.NewObjectId()
+	event.EventToken = generateToken(8)
+	fillTokens(event)
+	m.Lock()
+	defer m.Unlock()
+	for _, e := range m.events {
+		if e.EventToken == event.EventToken {
+			return &mgo.LastError{Code: 11000, Err: "duplicate key eventtoken"}
+		}
+	}
+	m.events[event.ID] = copyEvent(event)
+	return nil
+}
+
+func (m *MemoryDataStorage) UpdateEvent(event *Event) error {
+	fillTokens(event)
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.events[event.ID]; !ok {
+		return mgo.ErrNotFound
+	}
+	m.events[event.ID] = copyEvent(event)
+	return nil
+}
+
+func (m *MemoryDataStorage) DeleteEvent(eventId string) error {
+	if !bson.IsObjectIdHex(eventId) {
+		return mgo.ErrNotFound
+	}
+	id := bson.ObjectIdHex(eventId)
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.events[id]; !ok {
+		return mgo.ErrNotFound
+	}
+	delete(m.events, id)
+	return nil
+}
+
+func (m *MemoryDataStorage) EventByToken(token string) (*Event, error) {
+	m.RLock()
+	defer m.RUnlock()
+	for _, e := range m.events {
+		if e.EventToken == token {
+			return copyEvent(e), nil
+		}
+	}
+	return &Event{}, mgo.ErrNotFound
+}
+
+func (m *MemoryDataStorage) EventById(hexId string) (*Event, error) {
+	if !bson.IsObjectIdHex(hexId) {
+		return nil, mgo.ErrNotFound
+	}
+	m.RLock()
+	defer m.RUnlock()
+	e, ok := m.events[bson.ObjectIdHex(hexId)]
+	if !ok {
+		return nil, mgo.ErrNotFound
+	}
+	return copyEvent(e), nil
+}
+
+func (m *MemoryDataStorage) EventsPage(query *EventQuery) (*EventPage, error) {
+	events := make([]Event, 0)
+	m.RLock()
+	for _, e := range m.events {
+		if query.matches(e) {
+			events = append(events, *copyEvent(e))
+		}
+	}
+	m.RUnlock()
+	sort.Sort(byEventSort{events, query.Sort})
+	page := &EventPage{Events: make([]Event, 0), Total: len(events)}
+	if query.Offset < len(events) {
+		events = events[query.Offset:]
+		if len(events) > query.Limit {
+			events = events[:query.Limit]
+		}
+		page.Events = events
+	}
+	return page, nil
+}
+
+func (m *MemoryDataStorage) InsertQuestion(question *Question) error {
+	question.ID = bson.NewObjectId()
+	m.Lock()
+	m.questions[question.ID] = copyQuestion(question)
+	m.questionOrder = append(m.questionOrder, question.ID)
+	m.Unlock()
+	return nil
+}
+
+func (m *MemoryDataStorage) VoteQuestion(questionId, client string, operation int) error {
+	if !bson.IsObjectIdHex(questionId) {
+		return mgo.ErrNotFound
+	}
+	m.Lock()
+	defer m.Unlock()
+	q, ok := m.questions[bson.ObjectIdHex(questionId)]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	idx := -1
+	for i, voter := range q.Voters {
+		if voter == client {
+			idx = i
+			break
+		}
+	}
+	if operation == OperationRetract {
+		if idx < 0 {
+			return ErrNotVoted
+		}
+		q.Voters = append(q.Voters[:idx], q.Voters[idx+1:]...)
+		q.Vote--
+	} else {
+		if idx >= 0 {
+			return ErrAlreadyVoted
+		}
+		q.Voters = append(q.Voters, client)
+		q.Vote++
+	}
+	m.votes = append(m.votes, *newVote(q.ID, client, operation))
+	return nil
+}
+
+func (m *MemoryDataStorage) VotesByQuestion(questionID string) ([]Vote, error) {
+	result := make([]Vote, 0)
+	if !bson.IsObjectIdHex(questionID) {
+		return result, nil
+	}
+	id := bson.ObjectIdHex(questionID)
+	m.RLock()
+	for _, v := range m.votes {
+		if v.QuestionID == id {
+			result = append(result, v)
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) VotesByQuestions(questionIDs []bson.ObjectId) ([]Vote, error) {
+	result := make([]Vote, 0)
+	ids := make(map[bson.ObjectId]bool)
+	for _, id := range questionIDs {
+		ids[id] = true
+	}
+	m.RLock()
+	for _, v := range m.votes {
+		if ids[v.QuestionID] {
+			result = append(result, v)
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) QuestionById(questionID string) (*Question, error) {
+	if !bson.IsObjectIdHex(questionID) {
+		return &Question{}, mgo.ErrNotFound
+	}
+	m.RLock()
+	defer m.RUnlock()
+	q, ok := m.questions[bson.ObjectIdHex(questionID)]
+	if !ok {
+		return &Question{}, mgo.ErrNotFound
+	}
+	return copyQuestion(q), nil
+}
+
+func (m *MemoryDataStorage) QuestionsByEventAndSession(eventToken, sessiontToken string, states ...string) ([]Question, error) {
+	result := make([]Question, 0)
+	m.RLock()
+	for _, id := range m.questionOrder {
+		q := m.questions[id]
+		if q.EventToken == eventToken && q.SessionToken == sessiontToken && q.Visible() && inStates(q, states) {
+			result = append(result, *copyQuestion(q))
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) QuestionsPage(query *QuestionQuery) (*QuestionPage, error) {
+	questions, _ := m.QuestionsByEventAndSession(query.EventToken, query.SessionToken, query.States...)
+	switch query.Sort {
+	case SortTop:
+		sort.Sort(byTop(questions))
+	case SortNewest:
+		sort.Sort(byNewest(questions))
+	}
+	result := make([]Question, 0)
+	for i := range questions {
+		if query.After != nil && !query.After.isAfter(&questions[i]) {
+			continue
+		}
+		result = append(result, questions[i])
+		if len(result) > query.Limit {
+			break
+		}
+	}
+	return newQuestionPage(result, query), nil
+}
+
+// inStates reports whether the question is
+// in one of states, no states match all
+func inStates(q *Question, states []string) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, state := range states {
+		if q.QuestionState() == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryDataStorage) PendingQuestions(eventToken string) ([]Question, error) {
+	result := make([]Question, 0)
+	m.RLock()
+	for _, id := range m.questionOrder {
+		q := m.questions[id]
+		if q.EventToken == eventToken && q.Moderation == ModerationPending {
+			result = append(result, *copyQuestion(q))
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) ModerateQuestion(questionID, moderation string) error {
+	return m.updateQuestion(questionID, func(q *Question) {
+		q.Moderation = moderation
+	})
+}
+
+func (m *MemoryDataStorage) EditQuestion(question *Question) error {
+	return m.updateQuestion(question.ID.Hex(), func(q *Question) {
+		q.Question = question.Question
+		q.Flags = append([]Violation(nil), question.Flags...)
+		q.Moderation = question.Moderation
+	})
+}
+
+func (m *MemoryDataStorage) SetQuestionState(questionID, state string) error {
+	return m.updateQuestion(questionID, func(q *Question) {
+		q.State = state
+	})
+}
+
+func (m *MemoryDataStorage) QuestionsByAuthor(eventToken, authorHash string) ([]Question, error) {
+	result := make([]Question, 0)
+	m.RLock()
+	for _, id := range m.questionOrder {
+		q := m.questions[id]
+		if q.EventToken == eventToken && q.AuthorHash == authorHash {
+			result = append(result, *copyQuestion(q))
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) MergeQuestions(targetID string, sourceIDs []string) error {
+	if !bson.IsObjectIdHex(targetID) {
+		return mgo.ErrNotFound
+	}
+	m.Lock()
+	defer m.Unlock()
+	target, ok := m.questions[bson.ObjectIdHex(targetID)]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	voters := make(map[string]bool)
+	for _, voter := range target.Voters {
+		voters[voter] = true
+	}
+	for _, sourceID := range sourceIDs {
+		if !bson.IsObjectIdHex(sourceID) {
+			continue
+		}
+		id := bson.ObjectIdHex(sourceID)
+		source, ok := m.questions[id]
+		if !ok {
+			continue
+		}
+		// The client voting for more of the
+		// questions is counted only once
+		for _, voter := range source.Voters {
+			if !voters[voter] {
+				voters[voter] = true
+				target.Voters = append(target.Voters, voter)
+			}
+		}
+		for i := range m.votes {
+			if m.votes[i].QuestionID == id {
+				m.votes[i].QuestionID = target.ID
+			}
+		}
+		m.deleteQuestion(id)
+	}
+	target.Vote = len(target.Voters)
+	return nil
+}
+
+func (m *MemoryDataStorage) DeleteQuestion(questionID string) error {
+	if !bson.IsObjectIdHex(questionID) {
+		return mgo.ErrNotFound
+	}
+	id := bson.ObjectIdHex(questionID)
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.questions[id]; !ok {
+		return mgo.ErrNotFound
+	}
+	m.deleteQuestion(id)
+	votes := m.votes[:0]
+	for _, v := range m.votes {
+		if v.QuestionID != id {
+			votes = append(votes, v)
+		}
+	}
+	m.votes = votes
+	return nil
+}
+
+// deleteQuestion removes the question,
+// the caller holds the lock
+func (m *MemoryDataStorage) deleteQuestion(id bson.ObjectId) {
+	delete(m.questions, id)
+	for i, qid := range m.questionOrder {
+		if qid == id {
+			m.questionOrder = append(m.questionOrder[:i], m.questionOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// updateQuestion applies the update
+// to stored question under lock
+func (m *MemoryDataStorage) updateQuestion(questionID string, update func(q *Question)) error {
+	if !bson.IsObjectIdHex(questionID) {
+		return mgo.ErrNotFound
+	}
+	m.Lock()
+	defer m.Unlock()
+	q, ok := m.questions[bson.ObjectIdHex(questionID)]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	update(q)
+	return nil
+}
+
+func (m *MemoryDataStorage) InsertPoll(poll *Poll) error {
+	poll.ID = bson.NewObjectId()
+	m.Lock()
+	m.polls[poll.ID] = copyPoll(poll)
+	m.pollOrder = append(m.pollOrder, poll.ID)
+	m.Unlock()
+	return nil
+}
+
+func (m *MemoryDataStorage) PollById(pollID string) (*Poll, error) {
+	if !bson.IsObjectIdHex(pollID) {
+		return &Poll{}, mgo.ErrNotFound
+	}
+	m.RLock()
+	defer m.RUnlock()
+	p, ok := m.polls[bson.ObjectIdHex(pollID)]
+	if !ok {
+		return &Poll{}, mgo.ErrNotFound
+	}
+	return copyPoll(p), nil
+}
+
+func (m *MemoryDataStorage) PollsBySession(eventToken, sessionToken string) ([]Poll, error) {
+	result := make([]Poll, 0)
+	m.RLock()
+	for _, id := range m.pollOrder {
+		p := m.polls[id]
+		if p.EventToken == eventToken && p.SessionToken == sessionToken {
+			result = append(result, *copyPoll(p))
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) SetPollState(pollID, state string) error {
+	if !bson.IsObjectIdHex(pollID) {
+		return mgo.ErrNotFound
+	}
+	m.Lock()
+	defer m.Unlock()
+	p, ok := m.polls[bson.ObjectIdHex(pollID)]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	p.State = state
+	return nil
+}
+
+func (m *MemoryDataStorage) VotePoll(pollID, client string, choices []int) error {
+	if !bson.IsObjectIdHex(pollID) {
+		return mgo.ErrNotFound
+	}
+	m.Lock()
+	defer m.Unlock()
+	p, ok := m.polls[bson.ObjectIdHex(pollID)]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	if p.State != PollOpen {
+		return ErrPollClosed
+	}
+	for _, voter := range p.Voters {
+		if voter == client {
+			return ErrAlreadyVoted
+		}
+	}
+	for _, choice := range choices {
+		p.Options[choice].Votes++
+	}
+	p.Voted++
+	p.Voters = append(p.Voters, client)
+	if !p.Anonymous {
+		m.ballots = append(m.ballots, *newBallot(p.ID, client, choices))
+	}
+	return nil
+}
+
+func (m *MemoryDataStorage) BallotsByPoll(pollID string) ([]Ballot, error) {
+	result := make([]Ballot, 0)
+	if !bson.IsObjectIdHex(pollID) {
+		return result, nil
+	}
+	id := bson.ObjectIdHex(pollID)
+	m.RLock()
+	for _, b := range m.ballots {
+		if b.PollID == id {
+			result = append(result, b)
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) InsertPrompt(prompt *Prompt) error {
+	prompt.ID = bson.NewObjectId()
+	m.Lock()
+	m.prompts[prompt.ID] = copyPrompt(prompt)
+	m.promptOrder = append(m.promptOrder, prompt.ID)
+	m.Unlock()
+	return nil
+}
+
+func (m *MemoryDataStorage) PromptById(promptID string) (*Prompt, error) {
+	if !bson.IsObjectIdHex(promptID) {
+		return &Prompt{}, mgo.ErrNotFound
+	}
+	m.RLock()
+	defer m.RUnlock()
+	p, ok := m.prompts[bson.ObjectIdHex(promptID)]
+	if !ok {
+		return &Prompt{}, mgo.ErrNotFound
+	}
+	return copyPrompt(p), nil
+}
+
+func (m *MemoryDataStorage) PromptsBySession(eventToken, sessionToken string) ([]Prompt, error) {
+	result := make([]Prompt, 0)
+	m.RLock()
+	for _, id := range m.promptOrder {
+		p := m.prompts[id]
+		if p.EventToken == eventToken && p.SessionToken == sessionToken {
+			result = append(result, *copyPrompt(p))
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) SetPromptState(promptID, state string) error {
+	if !bson.IsObjectIdHex(promptID) {
+		return mgo.ErrNotFound
+	}
+	m.Lock()
+	defer m.Unlock()
+	p, ok := m.prompts[bson.ObjectIdHex(promptID)]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	p.State = state
+	return nil
+}
+
+func (m *MemoryDataStorage) RespondPrompt(response *PromptResponse) error {
+	m.Lock()
+	defer m.Unlock()
+	p, ok := m.prompts[response.PromptID]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	if p.State != PollOpen {
+		return ErrPollClosed
+	}
+	for _, responder := range p.Responders {
+		if responder == response.Client {
+			return ErrAlreadyVoted
+		}
+	}
+	if p.Counts == nil {
+		p.Counts = make(map[string]int)
+	}
+	p.Counts[response.Words]++
+	p.Responses++
+	p.Responders = append(p.Responders, response.Client)
+	response.ID = bson.NewObjectId()
+	m.responses = append(m.responses, *response)
+	return nil
+}
+
+func (m *MemoryDataStorage) ResponsesByPrompt(promptID string) ([]PromptResponse, error) {
+	result := make([]PromptResponse, 0)
+	if !bson.IsObjectIdHex(promptID) {
+		return result, nil
+	}
+	id := bson.ObjectIdHex(promptID)
+	m.RLock()
+	for _, r := range m.responses {
+		if r.PromptID == id {
+			result = append(result, r)
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) InsertRating(rating *Rating) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, r := range m.ratings {
+		if r.EventToken == rating.EventToken && r.SessionToken == rating.SessionToken && r.Client == rating.Client {
+			return ErrAlreadyRated
+		}
+	}
+	rating.ID = bson.NewObjectId()
+	m.ratings = append(m.ratings, *rating)
+	return nil
+}
+
+func (m *MemoryDataStorage) RatingsBySession(eventToken, sessionToken string) ([]Rating, error) {
+	result := make([]Rating, 0)
+	m.RLock()
+	for _, r := range m.ratings {
+		if r.EventToken == eventToken && r.SessionToken == sessionToken {
+			result = append(result, r)
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) RatingSummaries(eventToken string) ([]RatingSummary, error) {
+	result := make([]RatingSummary, 0)
+	index := make(map[string]int)
+	m.RLock()
+	for _, r := range m.ratings {
+		if r.EventToken != eventToken {
+			continue
+		}
+		i, ok := index[r.SessionToken]
+		if !ok {
+			i = len(result)
+			index[r.SessionToken] = i
+			result = append(result, RatingSummary{SessionToken: r.SessionToken})
+		}
+		rated := &RatingSummary{Count: 1, Sum: r.Stars}
+		if r.Stars >= 1 && r.Stars <= 5 {
+			rated.Stars[r.Stars-1] = 1
+		}
+		result[i].add(rated)
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) SessionActivities(eventToken string) ([]SessionActivity, error) {
+	result := make([]SessionActivity, 0)
+	index := make(map[string]int)
+	m.RLock()
+	for _, id := range m.questionOrder {
+		q := m.questions[id]
+		if q.EventToken != eventToken || !q.Visible() {
+			continue
+		}
+		i, ok := index[q.SessionToken]
+		if !ok {
+			i = len(result)
+			index[q.SessionToken] = i
+			result = append(result, SessionActivity{SessionToken: q.SessionToken})
+		}
+		result[i].Questions++
+		result[i].Votes += q.Vote
+		if q.State == StateAnswered {
+			result[i].Answered++
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+func (m *MemoryDataStorage) Participants(eventToken string) ([]SessionParticipants, int, error) {
+	type participant struct {
+		session string
+		client  string
+	}
+	seen := make(map[participant]bool)
+	clients := make(map[string]bool)
+	counts := make(map[string]int)
+	order := make([]string, 0)
+	add := func(session, client string) {
+		p := participant{session, client}
+		if len(client) == 0 || seen[p] {
+			return
+		}
+		seen[p] = true
+		clients[client] = true
+		if counts[session] == 0 {
+			order = append(order, session)
+		}
+		counts[session]++
+	}
+	m.RLock()
+	for _, id := range m.questionOrder {
+		if q := m.questions[id]; q.EventToken == eventToken {
+			add(q.SessionToken, q.Client)
+		}
+	}
+	for _, v := range m.votes {
+		if q, ok := m.questions[v.QuestionID]; ok && q.EventToken == eventToken {
+			add(q.SessionToken, v.Client)
+		}
+	}
+	m.RUnlock()
+	result := make([]SessionParticipants, 0, len(order))
+	for _, session := range order {
+		result = append(result, SessionParticipants{session, counts[session]})
+	}
+	return result, len(clients), nil
+}
+
+func (m *MemoryDataStorage) RecordPeak(eventToken, sessionToken string, count int, peakTime int64) error {
+	key := eventToken + "/" + sessionToken
+	m.Lock()
+	defer m.Unlock()
+	if p, ok := m.peaks[key]; ok && p.Peak >= count {
+		return nil
+	}
+	m.peaks[key] = &SessionPeak{eventToken, sessionToken, count, peakTime}
+	return nil
+}
+
+func (m *MemoryDataStorage) SessionPeaks(eventToken string) ([]SessionPeak, error) {
+	result := make([]SessionPeak, 0)
+	m.RLock()
+	for _, p := range m.peaks {
+		if p.EventToken == eventToken {
+			result = append(result, *p)
+		}
+	}
+	m.RUnlock()
+	return result, nil
+}
+
+// copyEvent creates a deep copy of event
+// so the stored data cannot be changed
+// outside of storage lock
+func copyEvent(e *Event) *Event {
+	c := *e
+	c.Rooms = append([]Room(nil), e.Rooms...)
+	c.Speakers = append([]string(nil), e.Speakers...)
+	c.Sessions = nil
+	for _, s := range e.Sessions {
+		s.Speaker = append([]string(nil), s.Speaker...)
+		c.Sessions = append(c.Sessions, s)
+	}
+	if e.RateLimits != nil {
+		c.RateLimits = make(map[string]string)
+		for route, spec := range e.RateLimits {
+			c.RateLimits[route] = spec
+		}
+	}
+	return &c
+}
+
+func copyQuestion(q *Question) *Question {
+	c := *q
+	c.Voters = append([]string(nil), q.Voters...)
+	c.Flags = append([]Violation(nil), q.Flags...)
+	return &c
+}
+
+func copyPoll(p *Poll) *Poll {
+	c := *p
+	c.Options = append([]PollOption(nil), p.Options...)
+	c.Voters = append([]string(nil), p.Voters...)
+	return &c
+}
+
+func copyPrompt(p *Prompt) *Prompt {
+	c := *p
+	c.Counts = make(map[string]int)
+	for words, count := range p.Counts {
+		c.Counts[words] = count
+	}
+	c.Responders = append([]string(nil), p.Responders...)
+	return &c
+}
+
+func copySpeaker(s *Speaker) *Speaker {
+	c := *s
+	c.URLs = append([]string(nil), s.URLs...)
+	return &c
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+)
+
+// setupMemoryBackend replaces the global
+// storage and managers with in-memory ones
+func setupMemoryBackend() *MemoryDataStorage {
+	gin.SetMode(gin.TestMode)
+	storage := NewMemoryStorage()
+	mongo = storage
+	manager := newMapEventManager(*wsCfg)
+	commMan = manager
+	notifier = manager
+	return storage
+}
+
+func TestMemoryEventStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	event := &Event{
+		Name:       "Java Intro",
+		FromDate:   time.Now().Unix(),
+		ToDate:     time.Now().Add(time.Hour).Unix(),
+		Rooms:      []Room{{Name: "U51/202"}},
+		Sessions:   []Session{{Room: "U51/202", Name: "Intro"}},
+		RateLimits: map[string]string{RouteQuestion: "5/1m"},
+	}
+	if err := storage.InsertEvent(event); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(event.EventToken) != 8 || len(event.Sessions[0].SessionToken) != 4 || len(event.Rooms[0].NameHash) != 4 {
+		t.Error("Tokens not filled")
+	}
+
+	stored, err := storage.EventByToken(event.EventToken)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	stored.Name = "Changed"
+	stored.Sessions[0].Name = "Changed"
+	stored.RateLimits[RouteQuestion] = "1/1h"
+	again, _ := storage.EventByToken(event.EventToken)
+	if again.Name != "Java Intro" || again.Sessions[0].Name != "Intro" || again.RateLimits[RouteQuestion] != "5/1m" {
+		t.Error("Stored event modified outside of storage")
+	}
+
+	if err := storage.DeleteEvent(event.ID.Hex()); err != nil {
+		t.Error(err)
+	}
+	if _, err := storage.EventByToken(event.EventToken); err != mgo.ErrNotFound {
+		t.Error("Event not deleted")
+	}
+}
+
+func TestMemoryQuestionStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	for _, text := range []string{"first", "second", "third"} {
+		storage.InsertQuestion(&Question{EventToken: "abcd", SessionToken: "1234", Question: text})
+	}
+	storage.InsertQuestion(&Question{EventToken: "abcd", SessionToken: "5678", Question: "other"})
+
+	questions, err := storage.QuestionsByEventAndSession("abcd", "1234")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(questions) != 3 || questions[0].Question != "first" || questions[2].Question != "third" {
+		t.Errorf("Unexpected questions %v", questions)
+		return
+	}
+
+	if err := storage.VoteQuestion(questions[1].ID.Hex(), "client1", OperationUpvote); err != nil {
+		t.Error(err)
+	}
+	q, _ := storage.QuestionById(questions[1].ID.Hex())
+	if q.Vote != 1 {
+		t.Error("Vote not stored")
+	}
+
+	flagged := &Question{EventToken: "abcd", SessionToken: "1234", Question: "flagged", Flags: []Violation{{Filter: "links"}}}
+	storage.InsertQuestion(flagged)
+	flagged.Flags[0].Filter = "changed"
+	q, _ = storage.QuestionById(flagged.ID.Hex())
+	q.Flags[0].Filter = "changed"
+	if q, _ := storage.QuestionById(flagged.ID.Hex()); q.Flags[0].Filter != "links" {
+		t.Error("Stored flags modified outside of storage")
+	}
+
+	if _, err := storage.QuestionById("notanid"); err != mgo.ErrNotFound {
+		t.Error("Invalid id should not be found")
+	}
+}
+
+func TestHandlersWithMemoryStorage(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+
+	body, _ := json.Marshal(&Question{
+		EventToken:   event.EventToken,
+		SessionToken: event.Sessions[0].SessionToken,
+		Question:     "What is new in Go?",
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/question", bytes.NewReader(body))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Question not posted %d", w.Code)
+		return
+	}
+	posted := &Question{}
+	json.Unmarshal(w.Body.Bytes(), posted)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/question/"+posted.ID.Hex(), nil)
+	req.Header.Set(ClientHeader, "client1")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Question not voted %d", w.Code)
+		return
+	}
+	voted := &Question{}
+	json.Unmarshal(w.Body.Bytes(), voted)
+	if voted.Vote != 1 {
+		t.Error("Vote not counted")
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/question/"+posted.ID.Hex(), nil)
+	req.Header.Set(ClientHeader, "client1")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Second vote of same client accepted %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/event/"+event.EventToken, nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Event not found %d", w.Code)
+	}
+}
+
+func TestMemoryVoteDeduplication(t *testing.T) {
+	storage := NewMemoryStorage()
+	question := &Question{EventToken: "abcd", SessionToken: "1234", Question: "first"}
+	storage.InsertQuestion(question)
+	id := question.ID.Hex()
+
+	if err := storage.VoteQuestion(id, "client1", OperationUpvote); err != nil {
+		t.Error(err)
+	}
+	if err := storage.VoteQuestion(id, "client1", OperationUpvote); err != ErrAlreadyVoted {
+		t.Error("Client voted twice")
+	}
+	if err := storage.VoteQuestion(id, "client2", OperationRetract); err != ErrNotVoted {
+		t.Error("Client retracted vote of other client")
+	}
+	if err := storage.VoteQuestion(id, "client2", OperationUpvote); err != nil {
+		t.Error(err)
+	}
+	if err := storage.VoteQuestion(id, "client1", OperationRetract); err != nil {
+		t.Error(err)
+	}
+
+	q, _ := storage.QuestionById(id)
+	if q.Vote != 1 || len(q.Voters) != 1 || q.Voters[0] != "client2" {
+		t.Errorf("Unexpected vote state %d %v", q.Vote, q.Voters)
+	}
+
+	votes, _ := storage.VotesByQuestion(id)
+	if len(votes) != 3 || votes[2].Operation != OperationRetract || votes[2].Client != "client1" {
+		t.Errorf("Unexpected vote history %v", votes)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Types of messages sent over
+// the event session socket
+const (
+	// MsgSnapshot carries the complete
+	// list of questions of session
+	MsgSnapshot = "snapshot"
+	// MsgQuestionAdded carries the
+	// newly posted question
+	MsgQuestionAdded = "question_added"
+	// MsgQuestionVoted carries the
+	// current vote count of question
+	MsgQuestionVoted = "question_voted"
+	// MsgQuestionRemoved carries the
+	// id of removed question
+	MsgQuestionRemoved = "question_removed"
+	// MsgQuestionEdited carries the
+	// question with changed text
+	MsgQuestionEdited = "question_edited"
+	// MsgQuestionState carries the
+	// new lifecycle state of question
+	MsgQuestionState = "question_state"
+	// MsgPoll carries the poll
+	// with its current results
+	MsgPoll = "poll"
+	// MsgPrompt carries the prompt
+	// with its current word cloud
+	MsgPrompt = "prompt"
+	// MsgFeedbackOpen carries the finished
+	// session open for ratings
+	MsgFeedbackOpen = "feedback_open"
+	// MsgPresence carries the live audience
+	// of event, it has no sequence number
+	MsgPresence = "presence"
+)
+
+// Types of messages received
+// from the event session socket
+const (
+	// MsgSnapshotRequest asks for the
+	// snapshot of session questions
+	MsgSnapshotRequest = "snapshot_request"
+	// MsgPostQuestion posts the question
+	// to the session of socket
+	MsgPostQuestion = "post_question"
+	// MsgVote upvotes the question
+	// referenced by QuestionRef
+	MsgVote = "vote"
+	// MsgUnvote retracts the vote of
+	// question referenced by QuestionRef
+	MsgUnvote = "unvote"
+	// MsgPollVote votes in the poll
+	// with data of PollVote
+	MsgPollVote = "poll_vote"
+	// MsgPromptResponse responds to the
+	// prompt with data of PromptAnswer
+	MsgPromptResponse = "prompt_response"
+)
+
+// Types of replies to the
+// client socket requests
+const (
+	MsgReply = "reply"
+	MsgError = "error"
+)
+
+// Error codes of the error replies
+const (
+	CodeMalformed      = "malformed"
+	CodeUnknownType    = "unknown_type"
+	CodeNotIdentified  = "not_identified"
+	CodeNotFound       = "not_found"
+	CodeInvalid        = "invalid"
+	CodeAlreadyVoted   = "already_voted"
+	CodeNotVoted       = "not_voted"
+	CodeNotAuthor      = "not_author"
+	CodeDuplicate      = "duplicate"
+	CodeContentRefused = "content_refused"
+	CodeRateLimited    = "rate_limited"
+	CodePollClosed     = "poll_closed"
+	CodeInternal       = "internal"
+)
+
+// Request is the message received from
+// client over event session socket, the
+// ID is returned in reply to correlate it
+// with request.
+type Request struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Reply is the response to client Request,
+// the Error is set for MsgError type.
+type Reply struct {
+	Type    string      `json:"type"`
+	ReplyTo string      `json:"replyTo"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   *ReplyError `json:"error,omitempty"`
+}
+
+type ReplyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Message is the envelope of every message
+// sent over event session socket. The Seq is
+// increasing per session, so the client
+// can detect the missed messages by gap
+// in sequence and request a snapshot. The
+// client reconnecting with the last Seq and
+// Stream receives only the missed messages.
+type Message struct {
+	Type         string      `json:"type"`
+	Seq          uint64      `json:"seq"`
+	Stream       string      `json:"stream,omitempty"`
+	EventToken   string      `json:"eventToken"`
+	SessionToken string      `json:"sessionToken"`
+	Data         interface{} `json:"data,omitempty"`
+	// Origin identifies the instance that
+	// published the message to broker, it
+	// is cleared before local delivery
+	Origin string `json:"origin,omitempty"`
+}
+
+// PollVote is the data of poll vote,
+// the choices are indexes of options
+type PollVote struct {
+	ID      bson.ObjectId `json:"id"`
+	Choices []int         `json:"choices"`
+}
+
+// PromptAnswer is the data
+// of response to prompt
+type PromptAnswer struct {
+	ID   bson.ObjectId `json:"id"`
+	Text string        `json:"text"`
+}
+
+// SnapshotRequest is the optional data
+// of snapshot request selecting the
+// ordering mode of questions
+type SnapshotRequest struct {
+	Sort string `json:"sort"`
+}
+
+// QuestionRef is the message data
+// referencing the question with its
+// absolute vote count, so applying
+// it repeatedly is harmless.
+type QuestionRef struct {
+	ID   bson.ObjectId `json:"id"`
+	Vote int           `json:"vote"`
+}
+
+// QuestionStateRef is the message data
+// referencing the question with its
+// new lifecycle state
+type QuestionStateRef struct {
+	ID    bson.ObjectId `json:"id"`
+	State string        `json:"state"`
+}
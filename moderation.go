@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ModerationSession is the session key
+// of moderator feed with the pending
+// questions of whole event
+const ModerationSession = "~moderation"
+
+// ModerationDecision is the body of
+// moderation request, the optional
+// question replaces the question text
+type ModerationDecision struct {
+	Moderation string `json:"moderation"`
+	Question   string `json:"question"`
+}
+
+// publicSession refuses to serve
+// the moderator feed on public routes
+func publicSession(c *gin.Context) {
+	if c.Params.ByName("session") == ModerationSession {
+		c.JSON(http.StatusForbidden, "Session not accessible")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func getPendingQuestions(c *gin.Context) {
+	eventToken := c.Params.ByName("eventtoken")
+	if ownedEvent(c, eventToken) == nil {
+		return
+	}
+	questions, err := mongo.PendingQuestions(eventToken)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load questions")
+		return
+	}
+	c.JSON(http.StatusOK, questions)
+}
+
+func moderationWebsockHandler(c *gin.Context) {
+	eventToken := c.Params.ByName("eventtoken")
+	if ownedEvent(c, eventToken) == nil {
+		return
+	}
+	serveSocket(c, eventToken, ModerationSession)
+}
+
+func moderateQuestion(c *gin.Context) {
+	decision := &ModerationDecision{}
+	if err := c.BindJSON(decision); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the decision")
+		return
+	}
+	if ownedQuestion(c, c.Params.ByName("questionID")) == nil {
+		return
+	}
+	q, err := applyModeration(c.Params.ByName("questionID"), decision)
+	if err == mgo.ErrNotFound {
+		log.Errorln(err)
+		c.JSON(http.StatusNotFound, "Question not exist")
+		return
+	}
+	if _, ok := err.(*ValidationError); ok {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if contentErr, ok := err.(*ContentError); ok {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, &ContentRejection{contentErr.Error(), contentErr.Violations})
+		return
+	}
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot moderate the question")
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+// applyModeration stores the decision and
+// notifies the moderators and, if the question
+// was approved, the session subscribers
+func applyModeration(questionID string, decision *ModerationDecision) (*Question, error) {
+	if decision.Moderation != ModerationApproved && decision.Moderation != ModerationRejected {
+		return nil, ErrModerationInvalid
+	}
+	if !bson.IsObjectIdHex(questionID) {
+		return nil, mgo.ErrNotFound
+	}
+	q, err := mongo.QuestionById(questionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(decision.Question) > 0 {
+		// The edited text is checked as the
+		// posted one, the flags of moderate
+		// policy are kept for the record
+		event, err := mongo.EventByToken(q.EventToken)
+		if err != nil {
+			return nil, err
+		}
+		edited := &Question{SessionToken: q.SessionToken, Question: decision.Question}
+		if err := ValidateQuestion(edited, event); err != nil {
+			return nil, err
+		}
+		if _, err := filterQuestion(edited, event); err != nil {
+			return nil, err
+		}
+		q.Question = edited.Question
+		q.Flags = edited.Flags
+		if err := mongo.EditQuestion(q); err != nil {
+			return nil, err
+		}
+	}
+	wasPending := q.Moderation == ModerationPending
+	wasVisible := q.Visible()
+	if err := mongo.ModerateQuestion(questionID, decision.Moderation); err != nil {
+		return nil, err
+	}
+	q.Moderation = decision.Moderation
+
+	if wasPending {
+		if err := notifyChange(q.EventToken, ModerationSession, MsgQuestionRemoved, &QuestionRef{q.ID, q.Vote}); err != nil {
+			log.Errorln(err)
+		}
+	}
+	msgType := ""
+	var data interface{}
+	switch {
+	case q.Visible() && !wasVisible:
+		msgType, data = MsgQuestionAdded, q
+	case !q.Visible() && wasVisible:
+		msgType, data = MsgQuestionRemoved, &QuestionRef{q.ID, q.Vote}
+	case q.Visible() && len(decision.Question) > 0:
+		msgType, data = MsgQuestionEdited, q
+	}
+	if len(msgType) > 0 {
+		if err := notifyChange(q.EventToken, q.SessionToken, msgType, data); err != nil {
+			log.Errorln(err)
+		}
+	}
+	return q, nil
+}
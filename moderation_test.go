@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+)
+
+func TestModerationQueue(t *testing.T) {
+	storage := setupMemoryBackend()
+	manager := commMan.(*MapEventManager)
+
+	event := &Event{Name: "Open Zlin", Moderated: true, Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	public := addIdleClient(manager, event.EventToken, sessionToken)
+	moderators := addIdleClient(manager, event.EventToken, ModerationSession)
+
+	question := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "Is it offensive?"}
+	if err := createQuestion(question); err != nil {
+		t.Fatal(err)
+	}
+	if question.Moderation != ModerationPending {
+		t.Errorf("Question not pending %s", question.Moderation)
+	}
+	if len(public.queue) != 0 || len(moderators.queue) != 1 {
+		t.Error("Pending question should be sent to moderators only")
+	}
+	if questions, _ := storage.QuestionsByEventAndSession(event.EventToken, sessionToken); len(questions) != 0 {
+		t.Error("Pending question listed publicly")
+	}
+	if _, err := castVote(question.ID.Hex(), "client1", OperationUpvote); err != mgo.ErrNotFound {
+		t.Error("Pending question voted")
+	}
+	if votes, _ := storage.VotesByQuestion(question.ID.Hex()); len(votes) != 0 {
+		t.Error("Vote of pending question stored")
+	}
+	snapshot, _ := snapshotMessage(event.EventToken, ModerationSession, "")
+	if pending, _ := snapshot.Data.([]Question); len(pending) != 1 {
+		t.Error("Moderator snapshot does not contain pending question")
+	}
+
+	if _, err := applyModeration(question.ID.Hex(), &ModerationDecision{Moderation: "maybe"}); err != ErrModerationInvalid {
+		t.Error("Invalid decision accepted")
+	}
+	approved, err := applyModeration(question.ID.Hex(), &ModerationDecision{
+		Moderation: ModerationApproved,
+		Question:   "Is it on topic?",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Question != "Is it on topic?" || !approved.Visible() {
+		t.Errorf("Unexpected approved question %v", approved)
+	}
+	if len(public.queue) != 1 || len(moderators.queue) != 2 {
+		t.Fatal("Approval not broadcast")
+	}
+	added := &Message{}
+	json.Unmarshal(<-public.queue, added)
+	if added.Type != MsgQuestionAdded {
+		t.Errorf("Unexpected public message %v", added)
+	}
+	questions, _ := storage.QuestionsByEventAndSession(event.EventToken, sessionToken)
+	if len(questions) != 1 || questions[0].Question != "Is it on topic?" {
+		t.Errorf("Approved question not listed %v", questions)
+	}
+
+	if _, err := applyModeration(question.ID.Hex(), &ModerationDecision{Moderation: ModerationRejected}); err != nil {
+		t.Error(err)
+	}
+	removed := &Message{}
+	json.Unmarshal(<-public.queue, removed)
+	if removed.Type != MsgQuestionRemoved {
+		t.Errorf("Rejected question not removed %v", removed)
+	}
+}
+
+func TestModerationFeedNotPublic(t *testing.T) {
+	setupMemoryBackend()
+	router := setupRouter()
+
+	for _, path := range []string{"/sse/abcd/" + ModerationSession, "/poll/abcd/" + ModerationSession} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Moderator feed served on %s with %d", path, w.Code)
+		}
+	}
+}
+
+func TestModeratorEditValidated(t *testing.T) {
+	storage := setupMemoryBackend()
+
+	event := &Event{Name: "Open Zlin", Moderated: true, Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	question := &Question{EventToken: event.EventToken, SessionToken: event.Sessions[0].SessionToken, Question: "Is it on topic?"}
+	if err := createQuestion(question); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{" \t ", strings.Repeat("x", MaxQuestionLength+1), "Why is it shit?"} {
+		if _, err := applyModeration(question.ID.Hex(), &ModerationDecision{Moderation: ModerationApproved, Question: text}); err == nil {
+			t.Errorf("Moderator edit %.20q accepted", text)
+		}
+	}
+	if q, _ := storage.QuestionById(question.ID.Hex()); q.Question != "Is it on topic?" || q.Moderation != ModerationPending {
+		t.Errorf("Refused moderator edit stored %v", q)
+	}
+	if _, err := applyModeration(question.ID.Hex(), &ModerationDecision{Moderation: ModerationApproved, Question: "Is it on the topic?"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// QuestionQuery selects the page of visible
+// questions of session. The After cursor is
+// the position of last question of previous
+// page in the same sort mode.
+type QuestionQuery struct {
+	EventToken   string
+	SessionToken string
+	States       []string
+	Sort         string
+	After        *Cursor
+	Limit        int
+}
+
+// QuestionPage is the page of questions,
+// the Next cursor is empty on last page
+type QuestionPage struct {
+	Questions []Question `json:"questions"`
+	Next      string     `json:"next,omitempty"`
+}
+
+// Cursor is the position in question
+// listing. The storage listings are keyed
+// by the sort key and id, the computed
+// trending listing by the offset.
+type Cursor struct {
+	Sort   string        `json:"s,omitempty"`
+	Vote   int           `json:"v,omitempty"`
+	ID     bson.ObjectId `json:"id,omitempty"`
+	Offset int           `json:"o,omitempty"`
+}
+
+// Encode returns the opaque
+// form of cursor for clients
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses the cursor
+// of the sort mode
+func decodeCursor(value, sortMode string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	cursor := &Cursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.Sort != sortMode {
+		return nil, ErrCursorInvalid
+	}
+	if sortMode != SortTrending && !cursor.ID.Valid() {
+		return nil, ErrCursorInvalid
+	}
+	if cursor.Offset < 0 {
+		return nil, ErrCursorInvalid
+	}
+	return cursor, nil
+}
+
+// cursorOf returns the cursor
+// positioned after the question
+func cursorOf(q *Question, sortMode string) *Cursor {
+	return &Cursor{Sort: sortMode, Vote: q.Vote, ID: q.ID}
+}
+
+// isAfter reports whether the question
+// follows the cursor in its sort mode
+func (c *Cursor) isAfter(q *Question) bool {
+	switch c.Sort {
+	case SortTop:
+		return q.Vote < c.Vote || (q.Vote == c.Vote && q.ID < c.ID)
+	case SortNewest:
+		return q.ID < c.ID
+	}
+	return q.ID > c.ID
+}
+
+// pageLimit bounds the requested
+// page size by the configuration
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return questionCfg.PageSize
+	}
+	if limit > questionCfg.MaxPageSize {
+		return questionCfg.MaxPageSize
+	}
+	return limit
+}
+
+// listQuestions returns the page of questions.
+// The trending order changes with time so it
+// is computed over all questions and paged
+// by offset, the others are paged by storage.
+func listQuestions(query *QuestionQuery) (*QuestionPage, error) {
+	if query.Sort != SortTrending {
+		return mongo.QuestionsPage(query)
+	}
+	questions, err := mongo.QuestionsByEventAndSession(query.EventToken, query.SessionToken, query.States...)
+	if err != nil {
+		return nil, err
+	}
+	if err := sortQuestions(questions, SortTrending, time.Now()); err != nil {
+		return nil, err
+	}
+	offset := 0
+	if query.After != nil {
+		offset = query.After.Offset
+	}
+	if offset > len(questions) {
+		offset = len(questions)
+	}
+	page := &QuestionPage{Questions: questions[offset:]}
+	if len(page.Questions) > query.Limit {
+		page.Questions = page.Questions[:query.Limit]
+		page.Next = (&Cursor{Sort: SortTrending, Offset: offset + query.Limit}).Encode()
+	}
+	return page, nil
+}
+
+// getQuestions lists the page of visible
+// questions of session. The state query
+// parameter takes comma separated list of
+// states, the sort parameter the ordering
+// mode, the after parameter the cursor of
+// previous page and limit the page size.
+func getQuestions(c *gin.Context) {
+	query := &QuestionQuery{
+		EventToken:   c.Params.ByName("eventtoken"),
+		SessionToken: c.Params.ByName("session"),
+		Sort:         c.Query("sort"),
+	}
+	if !ValidSort(query.Sort) {
+		c.JSON(http.StatusBadRequest, "Unknown sort mode")
+		return
+	}
+	states, err := queryStates(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	query.States = states
+	if param := c.Query("limit"); len(param) > 0 {
+		limit, err := strconv.Atoi(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		query.Limit = limit
+	}
+	if param := c.Query("after"); len(param) > 0 {
+		cursor, err := decodeCursor(param, query.Sort)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		query.After = cursor
+	}
+
+	query.Limit = pageLimit(query.Limit)
+	page, err := listQuestions(query)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load questions")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// queryStates parses the comma separated
+// states of the state query parameter
+func queryStates(c *gin.Context) ([]string, error) {
+	states := make([]string, 0)
+	if param := c.Query("state"); len(param) > 0 {
+		for _, state := range strings.Split(param, ",") {
+			if !ValidState(state) {
+				return nil, ErrStateInvalid
+			}
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
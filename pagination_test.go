@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestQuestionPagination(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Keynote"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	for i := 0; i < 7; i++ {
+		q := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: strconv.Itoa(i)}
+		createQuestion(q)
+		// Every other question gets
+		// a vote, so top order has ties
+		if i%2 == 0 {
+			castVote(q.ID.Hex(), "client1", OperationUpvote)
+		}
+	}
+
+	expected := map[string]string{
+		"":           "0123456",
+		SortTop:      "6420531",
+		SortNewest:   "6543210",
+		SortTrending: "6420531",
+	}
+	for mode, want := range expected {
+		got := ""
+		after := ""
+		for pages := 0; pages < 10; pages++ {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/questions/"+event.EventToken+"/"+sessionToken+"?limit=3&sort="+mode+"&after="+after, nil)
+			router.ServeHTTP(w, req)
+			page := &QuestionPage{}
+			json.Unmarshal(w.Body.Bytes(), page)
+			if w.Code != http.StatusOK || len(page.Questions) > 3 {
+				t.Fatalf("Unexpected page %d %v", w.Code, page)
+			}
+			for _, q := range page.Questions {
+				got += q.Question
+			}
+			if len(page.Next) == 0 {
+				break
+			}
+			after = page.Next
+		}
+		if got != want {
+			t.Errorf("Unexpected %q pages %s", mode, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/questions/"+event.EventToken+"/"+sessionToken+"?sort=top&after="+cursorOf(&Question{}, SortNewest).Encode(), nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Cursor of other sort accepted %d", w.Code)
+	}
+
+	forged := (&Cursor{Sort: SortTrending, Offset: -5}).Encode()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/questions/"+event.EventToken+"/"+sessionToken+"?sort=trending&after="+forged, nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Negative cursor offset accepted %d", w.Code)
+	}
+}
+
+func TestSnapshotLimit(t *testing.T) {
+	storage := setupMemoryBackend()
+	limit := questionCfg.SnapshotLimit
+	questionCfg.SnapshotLimit = 2
+	defer func() { questionCfg.SnapshotLimit = limit }()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Keynote"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	ids := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		q := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: strconv.Itoa(i)}
+		createQuestion(q)
+		ids = append(ids, q.ID.Hex())
+	}
+	castVote(ids[0], "client1", OperationUpvote)
+	castVote(ids[2], "client1", OperationUpvote)
+
+	snapshot, err := snapshotMessage(event.EventToken, sessionToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	questions, _ := snapshot.Data.([]Question)
+	if len(questions) != 2 || questions[0].Question != "0" || questions[1].Question != "2" {
+		t.Errorf("Unexpected snapshot %v", questions)
+	}
+}
+
+func TestQuestionConfigValidate(t *testing.T) {
+	for _, cfg := range []QuestionConfig{
+		{PageSize: 0, MaxPageSize: 200, SnapshotLimit: 100},
+		{PageSize: 50, MaxPageSize: 0, SnapshotLimit: 100},
+		{PageSize: 50, MaxPageSize: 200, SnapshotLimit: 0},
+	} {
+		if cfg.validate() == nil {
+			t.Errorf("Invalid config accepted %v", cfg)
+		}
+	}
+	if err := questionCfg.validate(); err != nil {
+		t.Error(err)
+	}
+}
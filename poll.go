@@ -0,0 +1,217 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PollChange is the body of
+// the poll state request
+type PollChange struct {
+	State string `json:"state"`
+}
+
+func postPoll(c *gin.Context) {
+	poll := &Poll{}
+	if err := c.BindJSON(poll); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the poll")
+		return
+	}
+	if ownedEvent(c, poll.EventToken) == nil {
+		return
+	}
+	err := createPoll(poll)
+	writePollResult(c, poll, err)
+}
+
+func putPollState(c *gin.Context) {
+	change := &PollChange{}
+	if err := c.BindJSON(change); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the state")
+		return
+	}
+	if ownedPoll(c, c.Params.ByName("pollID")) == nil {
+		return
+	}
+	poll, err := changePollState(c.Params.ByName("pollID"), change.State)
+	writePollResult(c, poll, err)
+}
+
+func votePoll(c *gin.Context) {
+	client := clientID(c)
+	if len(client) == 0 {
+		c.JSON(http.StatusBadRequest, "Client not identified")
+		return
+	}
+	vote := &PollVote{}
+	if err := c.BindJSON(vote); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the vote")
+		return
+	}
+	poll, err := castPollVote(c.Params.ByName("pollID"), client, vote.Choices)
+	writePollResult(c, poll, err)
+}
+
+func getPolls(c *gin.Context) {
+	polls, err := mongo.PollsBySession(c.Params.ByName("eventtoken"), c.Params.ByName("session"))
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load polls")
+		return
+	}
+	c.JSON(http.StatusOK, polls)
+}
+
+// getBallots lists the ballots of poll,
+// the anonymous polls have none
+func getBallots(c *gin.Context) {
+	pollID := c.Params.ByName("pollID")
+	if ownedPoll(c, pollID) == nil {
+		return
+	}
+	ballots, err := mongo.BallotsByPoll(pollID)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load ballots")
+		return
+	}
+	c.JSON(http.StatusOK, ballots)
+}
+
+// ownedPoll returns the poll of event created
+// by the authenticated user, otherwise the
+// error response is written and nil returned
+func ownedPoll(c *gin.Context, pollID string) *Poll {
+	if !bson.IsObjectIdHex(pollID) {
+		c.JSON(http.StatusNotFound, "Poll not exist")
+		return nil
+	}
+	poll, err := mongo.PollById(pollID)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusNotFound, "Poll not exist")
+		return nil
+	}
+	if ownedEvent(c, poll.EventToken) == nil {
+		return nil
+	}
+	return poll
+}
+
+// writePollResult maps the result of
+// poll operation to the response
+func writePollResult(c *gin.Context, poll *Poll, err error) {
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, poll)
+		return
+	case mgo.ErrNotFound:
+		c.JSON(http.StatusNotFound, "Poll not exist")
+	case ErrAlreadyVoted, ErrPollClosed:
+		c.JSON(http.StatusConflict, err.Error())
+	default:
+		if _, ok := err.(*ValidationError); ok {
+			c.JSON(http.StatusBadRequest, err.Error())
+		} else {
+			c.JSON(http.StatusInternalServerError, "Cannot store the poll")
+		}
+	}
+	log.Errorln(err)
+}
+
+// createPoll validates and stores the poll
+// and notifies the session subscribers
+func createPoll(poll *Poll) error {
+	event, err := mongo.EventByToken(poll.EventToken)
+	if err != nil {
+		return err
+	}
+	if len(poll.State) == 0 {
+		poll.State = PollClosed
+	}
+	if err := ValidatePoll(poll, event); err != nil {
+		return err
+	}
+	for i := range poll.Options {
+		poll.Options[i].Votes = 0
+	}
+	poll.Voted = 0
+	poll.Voters = nil
+	poll.CreateTime = time.Now().Unix()
+	if err := mongo.InsertPoll(poll); err != nil {
+		return err
+	}
+	notifyPoll(poll)
+	return nil
+}
+
+// changePollState opens or closes the
+// poll and notifies the session subscribers
+func changePollState(pollID, state string) (*Poll, error) {
+	if state != PollOpen && state != PollClosed {
+		return nil, ErrPollState
+	}
+	if !bson.IsObjectIdHex(pollID) {
+		return nil, mgo.ErrNotFound
+	}
+	if err := mongo.SetPollState(pollID, state); err != nil {
+		return nil, err
+	}
+	poll, err := mongo.PollById(pollID)
+	if err != nil {
+		return nil, err
+	}
+	notifyPoll(poll)
+	return poll, nil
+}
+
+// castPollVote counts the choices of client
+// and notifies the session subscribers
+// with the current results
+func castPollVote(pollID, client string, choices []int) (*Poll, error) {
+	if !bson.IsObjectIdHex(pollID) {
+		return nil, mgo.ErrNotFound
+	}
+	poll, err := mongo.PollById(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateChoices(poll, choices); err != nil {
+		return nil, err
+	}
+	if err := mongo.VotePoll(pollID, client, choices); err != nil {
+		return nil, err
+	}
+	if poll, err = mongo.PollById(pollID); err != nil {
+		return nil, err
+	}
+	notifyPoll(poll)
+	return poll, nil
+}
+
+func notifyPoll(poll *Poll) {
+	if err := notifyChange(poll.EventToken, poll.SessionToken, MsgPoll, poll); err != nil {
+		log.Errorln(err)
+	}
+}
+
+// polledEvent returns the event
+// token of the voted poll
+func polledEvent(c *gin.Context) string {
+	pollID := c.Params.ByName("pollID")
+	if !bson.IsObjectIdHex(pollID) {
+		return ""
+	}
+	poll, err := mongo.PollById(pollID)
+	if err != nil {
+		return ""
+	}
+	return poll.EventToken
+}
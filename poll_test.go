@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPollLifecycle(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	client := addIdleClient(commMan.(*MapEventManager), event.EventToken, sessionToken)
+
+	invalid := &Poll{EventToken: event.EventToken, SessionToken: sessionToken, Question: "Tabs?", Options: []PollOption{{Text: "Yes"}}}
+	if err := createPoll(invalid); err != ErrPollOptions {
+		t.Error("Poll with single option accepted")
+	}
+	poll := &Poll{
+		EventToken:   event.EventToken,
+		SessionToken: sessionToken,
+		Question:     "Tabs or spaces?",
+		Options:      []PollOption{{Text: "Tabs"}, {Text: "Spaces"}, {Text: "Both"}},
+	}
+	if err := createPoll(poll); err != nil {
+		t.Fatal(err)
+	}
+	if poll.State != PollClosed || len(client.queue) != 1 {
+		t.Error("Poll not created closed and broadcast")
+	}
+
+	vote := func(client string, choices ...int) int {
+		body, _ := json.Marshal(&PollVote{Choices: choices})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/poll/"+poll.ID.Hex()+"/vote", bytes.NewReader(body))
+		req.Header.Set(ClientHeader, client)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := vote("client1", 0); code != http.StatusConflict {
+		t.Errorf("Vote in closed poll %d", code)
+	}
+	if _, err := changePollState(poll.ID.Hex(), PollOpen); err != nil {
+		t.Fatal(err)
+	}
+	if code := vote("client1", 0, 1); code != http.StatusBadRequest {
+		t.Errorf("Multiple choices in single poll %d", code)
+	}
+	if code := vote("client1", 3); code != http.StatusBadRequest {
+		t.Errorf("Unknown option voted %d", code)
+	}
+	if code := vote("client1", 1); code != http.StatusOK {
+		t.Errorf("Vote not accepted %d", code)
+	}
+	if code := vote("client1", 0); code != http.StatusConflict {
+		t.Errorf("Client voted twice %d", code)
+	}
+	vote("client2", 1)
+
+	for len(client.queue) > 1 {
+		<-client.queue
+	}
+	msg := &Message{}
+	json.Unmarshal(<-client.queue, msg)
+	data, _ := msg.Data.(map[string]interface{})
+	if msg.Type != MsgPoll || data["voted"] != float64(2) {
+		t.Errorf("Unexpected poll message %v", msg)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/polls/"+event.EventToken+"/"+sessionToken, nil)
+	router.ServeHTTP(w, req)
+	polls := make([]Poll, 0)
+	json.Unmarshal(w.Body.Bytes(), &polls)
+	if len(polls) != 1 || polls[0].Options[1].Votes != 2 || polls[0].Options[0].Votes != 0 {
+		t.Errorf("Unexpected poll results %v", polls)
+	}
+	if ballots, _ := storage.BallotsByPoll(poll.ID.Hex()); len(ballots) != 2 || ballots[0].Client != "client1" {
+		t.Errorf("Unexpected ballots %v", ballots)
+	}
+}
+
+func TestAnonymousMultiplePoll(t *testing.T) {
+	storage := setupMemoryBackend()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	poll := &Poll{
+		EventToken:   event.EventToken,
+		SessionToken: event.Sessions[0].SessionToken,
+		Question:     "Which languages do you use?",
+		Options:      []PollOption{{Text: "Go"}, {Text: "Java"}, {Text: "Rust"}},
+		Multiple:     true,
+		Anonymous:    true,
+		State:        PollOpen,
+	}
+	createPoll(poll)
+
+	if _, err := castPollVote(poll.ID.Hex(), "client1", []int{0, 0}); err != ErrPollChoices {
+		t.Error("Repeated choice accepted")
+	}
+	voted, err := castPollVote(poll.ID.Hex(), "client1", []int{0, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voted.Voted != 1 || voted.Options[0].Votes != 1 || voted.Options[2].Votes != 1 {
+		t.Errorf("Unexpected results %v", voted)
+	}
+	if ballots, _ := storage.BallotsByPoll(poll.ID.Hex()); len(ballots) != 0 {
+		t.Error("Ballot of anonymous poll stored")
+	}
+}
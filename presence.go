@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionAudience is the number of
+// live connections to event session
+type SessionAudience struct {
+	EventToken   string `json:"eventToken"`
+	SessionToken string `json:"sessionToken"`
+	Count        int    `json:"count"`
+}
+
+// byAudience sorts the sessions
+// from the largest audience
+type byAudience []SessionAudience
+
+func (slice byAudience) Len() int {
+	return len(slice)
+}
+
+func (slice byAudience) Less(i, j int) bool {
+	return slice[i].Count > slice[j].Count
+}
+
+func (slice byAudience) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// Audience is the live audience of event,
+// the counts are kept per service instance.
+type Audience struct {
+	EventToken string         `json:"eventToken"`
+	Total      int            `json:"total"`
+	Sessions   map[string]int `json:"sessions"`
+}
+
+// eventAudiences groups the session
+// audiences by event token
+func eventAudiences(sessions []SessionAudience) map[string]*Audience {
+	events := make(map[string]*Audience)
+	for _, s := range sessions {
+		a := events[s.EventToken]
+		if a == nil {
+			a = &Audience{EventToken: s.EventToken, Sessions: make(map[string]int)}
+			events[s.EventToken] = a
+		}
+		a.Sessions[s.SessionToken] = s.Count
+		a.Total += s.Count
+	}
+	return events
+}
+
+// presencePump sends the audience of event to
+// all its sessions, at most once per interval
+// and only if the audience changed.
+func presencePump(manager EventManager, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := make(map[string]*Audience)
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		current := eventAudiences(manager.Audiences())
+		for eventToken, audience := range current {
+			if previous := last[eventToken]; previous != nil && sameAudience(previous, audience) {
+				continue
+			}
+			for sessionToken := range audience.Sessions {
+				// The presence is not part of
+				// session sequence, so it is
+				// sent without the Seq
+				manager.SendJsonByEventAndSessionToken(eventToken, sessionToken, &Message{
+					Type:         MsgPresence,
+					EventToken:   eventToken,
+					SessionToken: sessionToken,
+					Data:         audience,
+				})
+			}
+		}
+		last = current
+	}
+}
+
+func sameAudience(a, b *Audience) bool {
+	if a.Total != b.Total || len(a.Sessions) != len(b.Sessions) {
+		return false
+	}
+	for session, count := range a.Sessions {
+		if b.Sessions[session] != count {
+			return false
+		}
+	}
+	return true
+}
+
+func getPresence(c *gin.Context) {
+	eventToken := c.Params.ByName("eventtoken")
+	audience := eventAudiences(commMan.Audiences())[eventToken]
+	if audience == nil {
+		audience = &Audience{EventToken: eventToken, Sessions: make(map[string]int)}
+	}
+	c.JSON(http.StatusOK, audience)
+}
+
+// getBusiestSessions lists the sessions of events
+// created by the authenticated organizer with the
+// largest live audience of this instance
+func getBusiestSessions(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusUnauthorized, "User not identified")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	owned := make(map[string]bool)
+	sessions := make([]SessionAudience, 0)
+	for _, s := range commMan.Audiences() {
+		own, checked := owned[s.EventToken]
+		if !checked {
+			event, err := mongo.EventByToken(s.EventToken)
+			own = err == nil && event.CreatedBy == user.Email
+			owned[s.EventToken] = own
+		}
+		if own {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Sort(byAudience(sessions))
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	c.JSON(http.StatusOK, sessions)
+}
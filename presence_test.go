@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPresencePump(t *testing.T) {
+	manager := newMapEventManager(*wsCfg)
+	first := manager.Subscribe("abcd", "1234")
+	manager.Subscribe("abcd", "1234")
+	second := manager.Subscribe("abcd", "5678")
+	manager.Subscribe("efgh", "1234")
+	moderator := manager.Subscribe("abcd", ModerationSession)
+
+	done := make(chan struct{})
+	defer close(done)
+	go presencePump(manager, 20*time.Millisecond, done)
+
+	if !waitFor(func() bool { return len(first.queue) > 0 && len(second.queue) > 0 }) {
+		t.Fatal("Presence not sent")
+	}
+	received := struct {
+		Message
+		Data Audience `json:"data"`
+	}{}
+	json.Unmarshal(<-second.queue, &received)
+	if received.Type != MsgPresence || received.Seq != 0 {
+		t.Errorf("Unexpected presence message %v", received.Message)
+	}
+	if received.Data.Total != 3 || received.Data.Sessions["1234"] != 2 || received.Data.Sessions["5678"] != 1 ||
+		len(received.Data.Sessions) != 2 {
+		t.Errorf("Unexpected audience %v", received.Data)
+	}
+	if len(moderator.queue) != 0 {
+		t.Error("Presence sent to moderators")
+	}
+
+	// Unchanged audience is not sent again
+	time.Sleep(60 * time.Millisecond)
+	if len(second.queue) != 0 {
+		t.Error("Unchanged presence sent again")
+	}
+}
+
+func TestBusiestSessions(t *testing.T) {
+	storage := setupMemoryBackend()
+	own := &Event{Name: "Open Zlin", CreatedBy: "ann@example.com"}
+	other := &Event{Name: "Other", CreatedBy: "bob@example.com"}
+	storage.InsertEvent(own)
+	storage.InsertEvent(other)
+	manager := newMapEventManager(*wsCfg)
+	commMan = manager
+	for i := 0; i < 3; i++ {
+		manager.Subscribe(own.EventToken, "busy")
+	}
+	manager.Subscribe(own.EventToken, "quiet")
+	for i := 0; i < 5; i++ {
+		manager.Subscribe(other.EventToken, "foreign")
+	}
+	for i := 0; i < 5; i++ {
+		manager.Subscribe(own.EventToken, ModerationSession)
+	}
+
+	router := gin.New()
+	router.GET("/busiest", func(c *gin.Context) {
+		c.Request.Header.Set(TokenHeader, `{"email":"ann@example.com"}`)
+	}, getBusiestSessions)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/busiest?limit=1", nil)
+	router.ServeHTTP(w, req)
+
+	sessions := make([]SessionAudience, 0)
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if len(sessions) != 1 || sessions[0].SessionToken != "busy" || sessions[0].Count != 3 {
+		t.Errorf("Unexpected busiest sessions %v", sessions)
+	}
+}
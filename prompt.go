@@ -0,0 +1,342 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// MaxPromptWords is the largest
+	// number of words of response
+	MaxPromptWords = 3
+	// MaxCloudWords is the number of
+	// responses shown in the word cloud
+	MaxCloudWords = 50
+)
+
+// WordCount is the normalized
+// response with its frequency
+type WordCount struct {
+	Words string `json:"words"`
+	Count int    `json:"count"`
+}
+
+// byCount orders the word cloud by
+// frequency, the ties alphabetically
+type byCount []WordCount
+
+func (a byCount) Len() int      { return len(a) }
+func (a byCount) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byCount) Less(i, j int) bool {
+	if a[i].Count != a[j].Count {
+		return a[i].Count > a[j].Count
+	}
+	return a[i].Words < a[j].Words
+}
+
+// stopwords are dropped from the
+// responses of prompt language
+var stopwords = map[string][]string{
+	"en": {"a", "an", "the", "and", "or", "but", "of", "to", "in", "on", "at", "for", "with",
+		"by", "is", "are", "was", "be", "it", "its", "this", "that", "i", "my", "we", "our",
+		"you", "your", "so", "very", "too", "just", "not", "no"},
+	"cs": {"a", "i", "k", "o", "s", "u", "v", "z", "se", "si", "na", "do", "za", "ze", "je",
+		"jsou", "to", "ten", "ta", "ale", "nebo", "pro", "po", "od", "jak", "že", "by", "moc",
+		"velmi", "už", "jen", "ne"},
+}
+
+var stopwordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool)
+	for lang, list := range stopwords {
+		sets[lang] = make(map[string]bool)
+		for _, word := range list {
+			sets[lang][word] = true
+		}
+	}
+	return sets
+}()
+
+// isStopword reports whether the word is stopword
+// of language, the empty language means any
+func isStopword(word, language string) bool {
+	if len(language) > 0 {
+		return stopwordSets[language][word]
+	}
+	for _, words := range stopwordSets {
+		if words[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeResponse lowers the response, drops the
+// punctuation and stopwords and joins the words
+// by single space, so the same answers are
+// counted together
+func normalizeResponse(text, language string, maxWords int) (string, error) {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	words := make([]string, 0, len(fields))
+	for _, word := range fields {
+		if !isStopword(word, language) {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return "", ErrResponseEmpty
+	}
+	if len(words) > maxWords {
+		return "", ErrResponseTooLong
+	}
+	return strings.Join(words, " "), nil
+}
+
+// withCloud fills the word cloud
+// of the most frequent responses
+func withCloud(prompt *Prompt) *Prompt {
+	cloud := make([]WordCount, 0, len(prompt.Counts))
+	for words, count := range prompt.Counts {
+		cloud = append(cloud, WordCount{words, count})
+	}
+	sort.Sort(byCount(cloud))
+	if len(cloud) > MaxCloudWords {
+		cloud = cloud[:MaxCloudWords]
+	}
+	prompt.Cloud = cloud
+	return prompt
+}
+
+func postPrompt(c *gin.Context) {
+	prompt := &Prompt{}
+	if err := c.BindJSON(prompt); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the prompt")
+		return
+	}
+	if ownedEvent(c, prompt.EventToken) == nil {
+		return
+	}
+	err := createPrompt(prompt)
+	writePromptResult(c, prompt, err)
+}
+
+func putPromptState(c *gin.Context) {
+	change := &PollChange{}
+	if err := c.BindJSON(change); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the state")
+		return
+	}
+	if ownedPrompt(c, c.Params.ByName("promptID")) == nil {
+		return
+	}
+	prompt, err := changePromptState(c.Params.ByName("promptID"), change.State)
+	writePromptResult(c, prompt, err)
+}
+
+func respondPrompt(c *gin.Context) {
+	client := clientID(c)
+	if len(client) == 0 {
+		c.JSON(http.StatusBadRequest, "Client not identified")
+		return
+	}
+	answer := &PromptAnswer{}
+	if err := c.BindJSON(answer); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the response")
+		return
+	}
+	prompt, err := addPromptResponse(c.Params.ByName("promptID"), client, answer.Text)
+	if cErr, ok := err.(*ContentError); ok {
+		c.JSON(http.StatusBadRequest, &ContentRejection{cErr.Error(), cErr.Violations})
+		return
+	}
+	writePromptResult(c, prompt, err)
+}
+
+func getPrompts(c *gin.Context) {
+	prompts, err := mongo.PromptsBySession(c.Params.ByName("eventtoken"), c.Params.ByName("session"))
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load prompts")
+		return
+	}
+	for i := range prompts {
+		withCloud(&prompts[i])
+	}
+	c.JSON(http.StatusOK, prompts)
+}
+
+// getResponses lists the raw
+// responses of prompt
+func getResponses(c *gin.Context) {
+	promptID := c.Params.ByName("promptID")
+	if ownedPrompt(c, promptID) == nil {
+		return
+	}
+	responses, err := mongo.ResponsesByPrompt(promptID)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load responses")
+		return
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// ownedPrompt returns the prompt of event
+// created by the authenticated user, otherwise
+// the error response is written and nil returned
+func ownedPrompt(c *gin.Context, promptID string) *Prompt {
+	if !bson.IsObjectIdHex(promptID) {
+		c.JSON(http.StatusNotFound, "Prompt not exist")
+		return nil
+	}
+	prompt, err := mongo.PromptById(promptID)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusNotFound, "Prompt not exist")
+		return nil
+	}
+	if ownedEvent(c, prompt.EventToken) == nil {
+		return nil
+	}
+	return prompt
+}
+
+// writePromptResult maps the result of
+// prompt operation to the response
+func writePromptResult(c *gin.Context, prompt *Prompt, err error) {
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, withCloud(prompt))
+		return
+	case mgo.ErrNotFound:
+		c.JSON(http.StatusNotFound, "Prompt not exist")
+	case ErrAlreadyVoted, ErrPollClosed:
+		c.JSON(http.StatusConflict, err.Error())
+	default:
+		if _, ok := err.(*ValidationError); ok {
+			c.JSON(http.StatusBadRequest, err.Error())
+		} else {
+			c.JSON(http.StatusInternalServerError, "Cannot store the prompt")
+		}
+	}
+	log.Errorln(err)
+}
+
+// createPrompt validates and stores the prompt
+// and notifies the session subscribers
+func createPrompt(prompt *Prompt) error {
+	event, err := mongo.EventByToken(prompt.EventToken)
+	if err != nil {
+		return err
+	}
+	if len(prompt.State) == 0 {
+		prompt.State = PollClosed
+	}
+	if prompt.MaxWords == 0 {
+		prompt.MaxWords = 2
+	}
+	if len(prompt.Language) == 0 {
+		prompt.Language = event.Language
+	}
+	if err := ValidatePrompt(prompt, event); err != nil {
+		return err
+	}
+	prompt.Responses = 0
+	prompt.Counts = nil
+	prompt.Responders = nil
+	prompt.CreateTime = time.Now().Unix()
+	if err := mongo.InsertPrompt(prompt); err != nil {
+		return err
+	}
+	notifyPrompt(prompt)
+	return nil
+}
+
+// changePromptState opens or closes the
+// prompt and notifies the session subscribers
+func changePromptState(promptID, state string) (*Prompt, error) {
+	if state != PollOpen && state != PollClosed {
+		return nil, ErrPollState
+	}
+	if !bson.IsObjectIdHex(promptID) {
+		return nil, mgo.ErrNotFound
+	}
+	if err := mongo.SetPromptState(promptID, state); err != nil {
+		return nil, err
+	}
+	prompt, err := mongo.PromptById(promptID)
+	if err != nil {
+		return nil, err
+	}
+	notifyPrompt(prompt)
+	return prompt, nil
+}
+
+// addPromptResponse normalizes and counts the
+// response of client, the response refused by
+// content filters returns ContentError. The
+// session subscribers get the current cloud.
+func addPromptResponse(promptID, client, text string) (*Prompt, error) {
+	if !bson.IsObjectIdHex(promptID) {
+		return nil, mgo.ErrNotFound
+	}
+	prompt, err := mongo.PromptById(promptID)
+	if err != nil {
+		return nil, err
+	}
+	if contentFilter != nil {
+		if _, violations := contentFilter.Check(text, prompt.Language); len(violations) > 0 {
+			return nil, &ContentError{violations}
+		}
+	}
+	words, err := normalizeResponse(text, prompt.Language, prompt.MaxWords)
+	if err != nil {
+		return nil, err
+	}
+	response := &PromptResponse{
+		PromptID:     prompt.ID,
+		Client:       client,
+		Text:         text,
+		Words:        words,
+		ResponseTime: time.Now().Unix(),
+	}
+	if err := mongo.RespondPrompt(response); err != nil {
+		return nil, err
+	}
+	if prompt, err = mongo.PromptById(promptID); err != nil {
+		return nil, err
+	}
+	notifyPrompt(prompt)
+	return prompt, nil
+}
+
+func notifyPrompt(prompt *Prompt) {
+	if err := notifyChange(prompt.EventToken, prompt.SessionToken, MsgPrompt, withCloud(prompt)); err != nil {
+		log.Errorln(err)
+	}
+}
+
+// promptedEvent returns the event
+// token of the responded prompt
+func promptedEvent(c *gin.Context) string {
+	promptID := c.Params.ByName("promptID")
+	if !bson.IsObjectIdHex(promptID) {
+		return ""
+	}
+	prompt, err := mongo.PromptById(promptID)
+	if err != nil {
+		return ""
+	}
+	return prompt.EventToken
+}
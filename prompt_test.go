@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeResponse(t *testing.T) {
+	cases := []struct {
+		text, language string
+		words          string
+		err            error
+	}{
+		{"Go!", "en", "go", nil},
+		{"  The Machine-Learning ", "en", "machine learning", nil},
+		{"the and", "en", "", ErrResponseEmpty},
+		{"fast small cheap", "en", "", ErrResponseTooLong},
+		{"Je to rychlé", "cs", "rychlé", nil},
+		{"a rychlé", "", "rychlé", nil},
+	}
+	for _, c := range cases {
+		words, err := normalizeResponse(c.text, c.language, 2)
+		if words != c.words || err != c.err {
+			t.Errorf("Normalized %q to %q %v", c.text, words, err)
+		}
+	}
+}
+
+func TestPromptWordCloud(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Language: "en", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	client := addIdleClient(commMan.(*MapEventManager), event.EventToken, sessionToken)
+
+	prompt := &Prompt{EventToken: event.EventToken, SessionToken: sessionToken, Question: "One word for Go?", State: PollOpen}
+	if err := createPrompt(prompt); err != nil {
+		t.Fatal(err)
+	}
+	if prompt.MaxWords != 2 || prompt.Language != "en" || len(client.queue) != 1 {
+		t.Errorf("Prompt not created with defaults and broadcast %v", prompt)
+	}
+
+	respond := func(client, text string) int {
+		body, _ := json.Marshal(&PromptAnswer{Text: text})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/prompt/"+prompt.ID.Hex()+"/response", bytes.NewReader(body))
+		req.Header.Set(ClientHeader, client)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := respond("client1", "Simple!"); code != http.StatusOK {
+		t.Errorf("Response not accepted %d", code)
+	}
+	if code := respond("client1", "fast"); code != http.StatusConflict {
+		t.Errorf("Client responded twice %d", code)
+	}
+	if code := respond("client2", "it is SIMPLE"); code != http.StatusOK {
+		t.Errorf("Response not accepted %d", code)
+	}
+	if code := respond("client3", "the"); code != http.StatusBadRequest {
+		t.Errorf("Stopword response accepted %d", code)
+	}
+	respond("client4", "fast")
+
+	for len(client.queue) > 1 {
+		<-client.queue
+	}
+	msg := &Message{}
+	json.Unmarshal(<-client.queue, msg)
+	if msg.Type != MsgPrompt {
+		t.Errorf("Unexpected prompt message %v", msg)
+	}
+
+	changePromptState(prompt.ID.Hex(), PollClosed)
+	if code := respond("client5", "fast"); code != http.StatusConflict {
+		t.Errorf("Response to closed prompt %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/prompts/"+event.EventToken+"/"+sessionToken, nil)
+	router.ServeHTTP(w, req)
+	prompts := make([]Prompt, 0)
+	json.Unmarshal(w.Body.Bytes(), &prompts)
+	if len(prompts) != 1 || prompts[0].Responses != 3 {
+		t.Fatalf("Unexpected prompts %v", prompts)
+	}
+	cloud := prompts[0].Cloud
+	if len(cloud) != 2 || cloud[0] != (WordCount{"simple", 2}) || cloud[1] != (WordCount{"fast", 1}) {
+		t.Errorf("Unexpected word cloud %v", cloud)
+	}
+	if responses, _ := storage.ResponsesByPrompt(prompt.ID.Hex()); len(responses) != 3 || responses[1].Text != "it is SIMPLE" {
+		t.Errorf("Responses not stored %v", responses)
+	}
+}
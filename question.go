@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrNotAuthor   = errors.New("question: author secret does not match")
+	ErrEditExpired = errors.New("question: edit grace period expired")
+)
+
+// MinSecretLength is the shortest
+// author secret accepted from client
+const MinSecretLength = 16
+
+// QuestionEdit is the body of
+// question edit request
+type QuestionEdit struct {
+	Question string `json:"question"`
+}
+
+// hashSecret returns the stored
+// form of author secret
+func hashSecret(secret string) string {
+	sha := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sha[:])
+}
+
+// isAuthor reports whether the secret
+// is the author secret of question
+func isAuthor(q *Question, secret string) bool {
+	if len(secret) == 0 || len(q.AuthorHash) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(q.AuthorHash), []byte(hashSecret(secret))) == 1
+}
+
+// authorSecret returns the author secret
+// of request, the query parameter is
+// accepted like for the client
+func authorSecret(c *gin.Context) string {
+	secret := c.Request.Header.Get(AuthorHeader)
+	if len(secret) == 0 {
+		secret = c.Query("secret")
+	}
+	return secret
+}
+
+func editQuestion(c *gin.Context) {
+	edit := &QuestionEdit{}
+	if err := c.BindJSON(edit); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the question")
+		return
+	}
+	q, err := changeQuestionText(c.Params.ByName("questionID"), authorSecret(c), edit.Question)
+	writeQuestionResult(c, q, err)
+}
+
+// authorOrToken lets the request with author
+// secret through, the others must be
+// authenticated organizers
+func authorOrToken(c *gin.Context) {
+	if len(authorSecret(c)) > 0 {
+		c.Next()
+		return
+	}
+	authToken(c)
+}
+
+// deleteQuestion deletes the question of
+// organizer or withdraws the question of
+// author identified by the author secret
+func deleteQuestion(c *gin.Context) {
+	questionID := c.Params.ByName("questionID")
+	if secret := authorSecret(c); len(secret) > 0 {
+		if !bson.IsObjectIdHex(questionID) {
+			writeQuestionResult(c, nil, mgo.ErrNotFound)
+			return
+		}
+		q, err := mongo.QuestionById(questionID)
+		if err != nil {
+			writeQuestionResult(c, nil, err)
+			return
+		}
+		if !isAuthor(q, secret) {
+			writeQuestionResult(c, nil, ErrNotAuthor)
+			return
+		}
+	} else if ownedQuestion(c, questionID) == nil {
+		return
+	}
+	q, err := removeQuestion(questionID)
+	writeQuestionResult(c, q, err)
+}
+
+// getAuthorQuestions lists all the questions
+// of author in event, including the ones
+// waiting for moderation
+func getAuthorQuestions(c *gin.Context) {
+	secret := authorSecret(c)
+	if len(secret) == 0 {
+		c.JSON(http.StatusBadRequest, "Author not identified")
+		return
+	}
+	questions, err := mongo.QuestionsByAuthor(c.Params.ByName("eventtoken"), hashSecret(secret))
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load questions")
+		return
+	}
+	c.JSON(http.StatusOK, questions)
+}
+
+// writeQuestionResult maps the result of
+// question operation to the response
+func writeQuestionResult(c *gin.Context, q *Question, err error) {
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, q)
+		return
+	case mgo.ErrNotFound:
+		c.JSON(http.StatusNotFound, "Question not exist")
+	case ErrNotAuthor, ErrEditExpired:
+		c.JSON(http.StatusForbidden, err.Error())
+	case ErrMergeConflict:
+		c.JSON(http.StatusConflict, err.Error())
+	default:
+		if _, ok := err.(*ValidationError); ok {
+			c.JSON(http.StatusBadRequest, err.Error())
+		} else if contentErr, ok := err.(*ContentError); ok {
+			c.JSON(http.StatusBadRequest, &ContentRejection{contentErr.Error(), contentErr.Violations})
+		} else {
+			c.JSON(http.StatusInternalServerError, "Cannot change the question")
+		}
+	}
+	log.Errorln(err)
+}
+
+// changeQuestionText edits the question of
+// author within the grace period. The edited
+// question of moderated event, or flagged by
+// content filters, returns to the moderation
+// queue.
+func changeQuestionText(questionID, secret, text string) (*Question, error) {
+	if !bson.IsObjectIdHex(questionID) {
+		return nil, mgo.ErrNotFound
+	}
+	q, err := mongo.QuestionById(questionID)
+	if err != nil {
+		return nil, err
+	}
+	if q.Moderation == ModerationRejected {
+		return nil, mgo.ErrNotFound
+	}
+	if !isAuthor(q, secret) {
+		return nil, ErrNotAuthor
+	}
+	if time.Since(time.Unix(q.CreateTime, 0)) > questionCfg.EditGracePeriod {
+		return nil, ErrEditExpired
+	}
+	event, err := mongo.EventByToken(q.EventToken)
+	if err != nil {
+		return nil, err
+	}
+	edited := &Question{SessionToken: q.SessionToken, Question: text}
+	if err := ValidateQuestion(edited, event); err != nil {
+		return nil, err
+	}
+	flagged, err := filterQuestion(edited, event)
+	if err != nil {
+		return nil, err
+	}
+	// The edited text goes back to moderation
+	// together with its flags in single update
+	wasPending := q.Moderation == ModerationPending
+	q.Question = edited.Question
+	q.Flags = edited.Flags
+	if event.Moderated || flagged {
+		q.Moderation = ModerationPending
+	}
+	if err := mongo.EditQuestion(q); err != nil {
+		return nil, err
+	}
+
+	var updateErr error
+	switch {
+	case wasPending:
+		updateErr = notifyChange(q.EventToken, ModerationSession, MsgQuestionEdited, q)
+	case q.Moderation == ModerationPending:
+		if err := notifyChange(q.EventToken, q.SessionToken, MsgQuestionRemoved, &QuestionRef{q.ID, q.Vote}); err != nil {
+			log.Errorln(err)
+		}
+		updateErr = notifyChange(q.EventToken, ModerationSession, MsgQuestionAdded, q)
+	default:
+		updateErr = notifyChange(q.EventToken, q.SessionToken, MsgQuestionEdited, q)
+	}
+	if updateErr != nil {
+		log.Errorln(updateErr)
+	}
+	return q, nil
+}
+
+// removeQuestion deletes the question and
+// notifies the subscribers that have seen it
+func removeQuestion(questionID string) (*Question, error) {
+	if !bson.IsObjectIdHex(questionID) {
+		return nil, mgo.ErrNotFound
+	}
+	q, err := mongo.QuestionById(questionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := mongo.DeleteQuestion(questionID); err != nil {
+		return nil, err
+	}
+	sessionToken := q.SessionToken
+	if q.Moderation == ModerationPending {
+		sessionToken = ModerationSession
+	}
+	if q.Moderation != ModerationRejected {
+		updateErr := notifyChange(q.EventToken, sessionToken, MsgQuestionRemoved, &QuestionRef{q.ID, q.Vote})
+		if updateErr != nil {
+			log.Errorln(updateErr)
+		}
+	}
+	return q, nil
+}
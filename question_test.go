@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuestionEditAndDelete(t *testing.T) {
+	storage := setupMemoryBackend()
+	manager := commMan.(*MapEventManager)
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	client := addIdleClient(manager, event.EventToken, sessionToken)
+
+	body, _ := json.Marshal(&Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "Typo?"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/question", bytes.NewReader(body))
+	router.ServeHTTP(w, req)
+	posted := &Question{}
+	json.Unmarshal(w.Body.Bytes(), posted)
+	if len(posted.AuthorSecret) == 0 {
+		t.Fatal("Author secret not returned")
+	}
+	added := &Message{}
+	json.Unmarshal(<-client.queue, added)
+	if data, _ := added.Data.(map[string]interface{}); data["authorSecret"] != nil {
+		t.Error("Author secret broadcast")
+	}
+	stored, _ := storage.QuestionById(posted.ID.Hex())
+	if stored.AuthorHash != hashSecret(posted.AuthorSecret) || stored.AuthorSecret != "" {
+		t.Error("Author secret stored in plain")
+	}
+
+	edit := func(secret string) int {
+		body, _ := json.Marshal(&QuestionEdit{Question: "No typo?"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/question/"+posted.ID.Hex(), bytes.NewReader(body))
+		req.Header.Set(AuthorHeader, secret)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := edit("guess"); code != http.StatusForbidden {
+		t.Errorf("Edit with wrong secret %d", code)
+	}
+	if code := edit(posted.AuthorSecret); code != http.StatusOK {
+		t.Errorf("Edit of author rejected %d", code)
+	}
+	edited := &Message{}
+	json.Unmarshal(<-client.queue, edited)
+	if data, _ := edited.Data.(map[string]interface{}); edited.Type != MsgQuestionEdited || data["question"] != "No typo?" {
+		t.Errorf("Unexpected edit message %v", edited)
+	}
+	if _, err := changeQuestionText(posted.ID.Hex(), posted.AuthorSecret, " \t "); err != ErrQuestionEmpty {
+		t.Errorf("Blank edit accepted %v", err)
+	}
+
+	grace := questionCfg.EditGracePeriod
+	questionCfg.EditGracePeriod = -time.Second
+	if code := edit(posted.AuthorSecret); code != http.StatusForbidden {
+		t.Errorf("Edit after grace period %d", code)
+	}
+	questionCfg.EditGracePeriod = grace
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/question/"+posted.ID.Hex(), nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Delete without token %d", w.Code)
+	}
+
+	if _, err := removeQuestion(posted.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	removed := &Message{}
+	json.Unmarshal(<-client.queue, removed)
+	if removed.Type != MsgQuestionRemoved {
+		t.Errorf("Unexpected delete message %v", removed)
+	}
+	if questions, _ := storage.QuestionsByEventAndSession(event.EventToken, sessionToken); len(questions) != 0 {
+		t.Error("Question not deleted")
+	}
+}
+
+func TestEditOfModeratedQuestion(t *testing.T) {
+	storage := setupMemoryBackend()
+	manager := commMan.(*MapEventManager)
+
+	event := &Event{Name: "Open Zlin", Moderated: true, Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	question := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "Nice?"}
+	createQuestion(question)
+	applyModeration(question.ID.Hex(), &ModerationDecision{Moderation: ModerationApproved})
+	public := addIdleClient(manager, event.EventToken, sessionToken)
+	moderators := addIdleClient(manager, event.EventToken, ModerationSession)
+
+	q, err := changeQuestionText(question.ID.Hex(), question.AuthorSecret, "Offensive!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Moderation != ModerationPending || len(public.queue) != 1 || len(moderators.queue) != 1 {
+		t.Error("Edited question not returned to moderation")
+	}
+}
+
+func TestAuthorQuestions(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}, {Name: "Outro"}}}
+	storage.InsertEvent(event)
+
+	first := &Question{EventToken: event.EventToken, SessionToken: event.Sessions[0].SessionToken, Question: "First?"}
+	createQuestion(first)
+	secret := first.AuthorSecret
+	second := &Question{
+		EventToken:   event.EventToken,
+		SessionToken: event.Sessions[1].SessionToken,
+		Question:     "Second?",
+		AuthorSecret: secret,
+	}
+	if err := createQuestion(second); err != nil {
+		t.Fatal(err)
+	}
+	if len(second.AuthorSecret) != 0 {
+		t.Error("Author secret returned again")
+	}
+	createQuestion(&Question{EventToken: event.EventToken, SessionToken: event.Sessions[0].SessionToken, Question: "Other?"})
+	forged := &Question{EventToken: event.EventToken, SessionToken: event.Sessions[0].SessionToken, Question: "Forged?", AuthorSecret: "guess"}
+	if err := createQuestion(forged); err != ErrNotAuthor {
+		t.Error("Short secret accepted")
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/author/"+event.EventToken, nil)
+	req.Header.Set(AuthorHeader, secret)
+	router.ServeHTTP(w, req)
+	mine := make([]Question, 0)
+	json.Unmarshal(w.Body.Bytes(), &mine)
+	if len(mine) != 2 || mine[0].Question != "First?" || mine[1].Question != "Second?" {
+		t.Errorf("Unexpected author questions %v", mine)
+	}
+
+	withdraw := func(id, secret string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/question/"+id, nil)
+		req.Header.Set(AuthorHeader, secret)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := withdraw(second.ID.Hex(), "guess"); code != http.StatusForbidden {
+		t.Errorf("Withdraw with wrong secret %d", code)
+	}
+	if code := withdraw(second.ID.Hex(), secret); code != http.StatusOK {
+		t.Errorf("Withdraw of author rejected %d", code)
+	}
+	if mine, _ := storage.QuestionsByAuthor(event.EventToken, hashSecret(secret)); len(mine) != 1 {
+		t.Error("Question not withdrawn")
+	}
+	withdraw(first.ID.Hex(), secret)
+
+	// The secret stays valid after the
+	// author withdrew all questions
+	again := &Question{EventToken: event.EventToken, SessionToken: event.Sessions[0].SessionToken, Question: "Again?", AuthorSecret: secret}
+	if err := createQuestion(again); err != nil {
+		t.Errorf("Secret of withdrawn questions refused %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Ordering modes of question listings,
+// the empty mode keeps the posting order.
+// The ties are broken by the id, so the
+// newer question goes first.
+const (
+	SortTop      = "top"
+	SortNewest   = "newest"
+	SortTrending = "trending"
+)
+
+// ValidSort reports whether the
+// mode is known ordering mode
+func ValidSort(mode string) bool {
+	switch mode {
+	case "", SortTop, SortNewest, SortTrending:
+		return true
+	}
+	return false
+}
+
+type byPosting []Question
+
+func (s byPosting) Len() int           { return len(s) }
+func (s byPosting) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPosting) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+type byTop []Question
+
+func (s byTop) Len() int      { return len(s) }
+func (s byTop) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byTop) Less(i, j int) bool {
+	if s[i].Vote != s[j].Vote {
+		return s[i].Vote > s[j].Vote
+	}
+	return s[i].ID > s[j].ID
+}
+
+type byNewest []Question
+
+func (s byNewest) Len() int           { return len(s) }
+func (s byNewest) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byNewest) Less(i, j int) bool { return s[i].ID > s[j].ID }
+
+type byScore []Question
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].Score != s[j].Score {
+		return s[i].Score > s[j].Score
+	}
+	return s[i].ID > s[j].ID
+}
+
+// sortQuestions orders the questions by the
+// mode, the trending mode loads the votes
+// to score the questions
+func sortQuestions(questions []Question, mode string, now time.Time) error {
+	switch mode {
+	case SortTop:
+		sort.Stable(byTop(questions))
+	case SortNewest:
+		sort.Stable(byNewest(questions))
+	case SortTrending:
+		if err := scoreQuestions(questions, now); err != nil {
+			return err
+		}
+		sort.Stable(byScore(questions))
+	}
+	return nil
+}
+
+// scoreQuestions sets the trending score of
+// questions. The posting itself and each standing
+// upvote count halved with every TrendingHalfLife
+// of their age, so the recent questions and votes
+// outweigh the early ones.
+func scoreQuestions(questions []Question, now time.Time) error {
+	if len(questions) == 0 {
+		return nil
+	}
+	ids := make([]bson.ObjectId, 0)
+	index := make(map[bson.ObjectId]int)
+	for i := range questions {
+		ids = append(ids, questions[i].ID)
+		index[questions[i].ID] = i
+	}
+	votes, err := mongo.VotesByQuestions(ids)
+	if err != nil {
+		return err
+	}
+	// The votes come in time order, the
+	// retract cancels the upvote of client
+	standing := make(map[bson.ObjectId]map[string]int64)
+	for _, v := range votes {
+		if standing[v.QuestionID] == nil {
+			standing[v.QuestionID] = make(map[string]int64)
+		}
+		if v.Operation == OperationRetract {
+			delete(standing[v.QuestionID], v.Client)
+		} else {
+			standing[v.QuestionID][v.Client] = v.VoteTime
+		}
+	}
+	halfLife := questionCfg.TrendingHalfLife.Seconds()
+	for i := range questions {
+		questions[i].Score = decay(float64(now.Unix()-questions[i].CreateTime), halfLife)
+	}
+	for id, clients := range standing {
+		for _, voteTime := range clients {
+			questions[index[id]].Score += decay(float64(now.Unix()-voteTime), halfLife)
+		}
+	}
+	return nil
+}
+
+// decay returns the weight of
+// vote of age in seconds
+func decay(age, halfLife float64) float64 {
+	if age < 0 || halfLife <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, age/halfLife)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSortQuestions(t *testing.T) {
+	storage := setupMemoryBackend()
+	now := time.Now()
+
+	stale := &Question{EventToken: "abcd", SessionToken: "1234", Question: "stale", CreateTime: now.Add(-24 * time.Hour).Unix()}
+	old := &Question{EventToken: "abcd", SessionToken: "1234", Question: "old", CreateTime: now.Add(-time.Hour).Unix()}
+	fresh := &Question{EventToken: "abcd", SessionToken: "1234", Question: "fresh", CreateTime: now.Add(-time.Minute).Unix()}
+	idle := &Question{EventToken: "abcd", SessionToken: "1234", Question: "idle", CreateTime: now.Unix()}
+	for _, q := range []*Question{stale, old, fresh, idle} {
+		storage.InsertQuestion(q)
+	}
+	// Three early votes for the old question,
+	// two recent for the fresh one, and the
+	// recent vote of old question retracted,
+	// the idle question outranks the old ones
+	// by its own recent posting
+	vote := func(q *Question, client string, op int, ago time.Duration) {
+		v := newVote(q.ID, client, op)
+		v.VoteTime = now.Add(-ago).Unix()
+		storage.votes = append(storage.votes, *v)
+		if op == OperationUpvote {
+			q.Vote++
+		} else {
+			q.Vote--
+		}
+	}
+	vote(old, "c1", OperationUpvote, time.Hour)
+	vote(old, "c2", OperationUpvote, time.Hour)
+	vote(old, "c3", OperationUpvote, time.Hour)
+	vote(old, "c4", OperationUpvote, time.Minute)
+	vote(old, "c4", OperationRetract, time.Minute)
+	vote(fresh, "c1", OperationUpvote, time.Minute)
+	vote(fresh, "c2", OperationUpvote, time.Minute)
+
+	order := func(mode string) []string {
+		questions := []Question{*stale, *old, *fresh, *idle}
+		if err := sortQuestions(questions, mode, now); err != nil {
+			t.Fatal(err)
+		}
+		result := make([]string, 0)
+		for _, q := range questions {
+			result = append(result, q.Question)
+		}
+		return result
+	}
+	expected := map[string][]string{
+		"":           {"stale", "old", "fresh", "idle"},
+		SortTop:      {"old", "fresh", "idle", "stale"},
+		SortNewest:   {"idle", "fresh", "old", "stale"},
+		SortTrending: {"fresh", "idle", "old", "stale"},
+	}
+	for mode, want := range expected {
+		got := order(mode)
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Unexpected %q order %v", mode, got)
+				break
+			}
+		}
+	}
+}
+
+func TestSortedListing(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	first := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "first"}
+	second := &Question{EventToken: event.EventToken, SessionToken: sessionToken, Question: "second"}
+	createQuestion(first)
+	createQuestion(second)
+	castVote(second.ID.Hex(), "client1", OperationUpvote)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/questions/"+event.EventToken+"/"+sessionToken+"?sort=trending", nil)
+	router.ServeHTTP(w, req)
+	page := &QuestionPage{}
+	json.Unmarshal(w.Body.Bytes(), page)
+	questions := page.Questions
+	if len(questions) != 2 || questions[0].Question != "second" || questions[0].Score <= 0 {
+		t.Errorf("Unexpected trending listing %v", questions)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/questions/"+event.EventToken+"/"+sessionToken+"?sort=random", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown sort accepted %d", w.Code)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Rate limited routes, the names are
+// used as keys of event rate limits
+const (
+	RouteQuestion = "question"
+	RouteVote     = "vote"
+)
+
+// ForwardedForHeader is header with the
+// client address behind the proxy
+const ForwardedForHeader = "X-Forwarded-For"
+
+// maxMemoryBuckets is the number of buckets
+// over which the refilled buckets are dropped
+const maxMemoryBuckets = 10000
+
+// maxPostedBody is the largest body
+// read by the limiter of posted questions
+const maxPostedBody = 64 << 10
+
+// RateLimit allows Burst requests
+// refilled evenly over the Period
+type RateLimit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseRateLimit parses the limit
+// in form of "burst/period", e.g. "5/1m"
+func ParseRateLimit(spec string) (RateLimit, error) {
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("ratelimit: invalid limit %s", spec)
+	}
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst <= 0 {
+		return RateLimit{}, fmt.Errorf("ratelimit: invalid limit %s", spec)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return RateLimit{}, fmt.Errorf("ratelimit: invalid limit %s", spec)
+	}
+	return RateLimit{burst, period}, nil
+}
+
+// rate returns the tokens
+// refilled per second
+func (l RateLimit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// LimitStore keeps the token buckets, Take
+// takes the token from each bucket of limits
+// only if all of them have one, otherwise it
+// returns the longest wait for next token
+type LimitStore interface {
+	Take(limits map[string]RateLimit, now time.Time) (bool, time.Duration, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// MemoryLimitStore keeps the buckets
+// in memory of single instance
+type MemoryLimitStore struct {
+	*sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{
+		Mutex:   &sync.Mutex{},
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (s *MemoryLimitStore) Take(limits map[string]RateLimit, now time.Time) (bool, time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.buckets) > maxMemoryBuckets {
+		s.prune(now)
+	}
+	var wait time.Duration
+	for key, limit := range limits {
+		b, ok := s.buckets[key]
+		if !ok {
+			b = &bucket{float64(limit.Burst), now, limit.Period}
+			s.buckets[key] = b
+		}
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.rate())
+		b.last = now
+		b.period = limit.Period
+		if b.tokens < 1 {
+			if w := time.Duration((1 - b.tokens) / limit.rate() * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+	if wait > 0 {
+		return false, wait, nil
+	}
+	for key := range limits {
+		s.buckets[key].tokens--
+	}
+	return true, 0, nil
+}
+
+// prune drops the buckets refilled by
+// now, they are equal to the new ones
+func (s *MemoryLimitStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// redisTakeScript refills the buckets of keys
+// and takes the token of each atomically if all
+// have one, it returns the longest wait in
+// milliseconds or 0 if taken. The arguments
+// are the time and burst and rate of each key.
+const redisTakeScript = `
+local now = tonumber(ARGV[1])
+local buckets = {}
+local wait = 0
+for i, key in ipairs(KEYS) do
+	local burst = tonumber(ARGV[2 * i])
+	local rate = tonumber(ARGV[2 * i + 1])
+	local state = redis.call('HMGET', key, 'tokens', 'last')
+	local tokens = tonumber(state[1]) or burst
+	local last = tonumber(state[2]) or now
+	tokens = math.min(burst, tokens + math.max(0, now - last) * rate / 1000)
+	if tokens < 1 then
+		wait = math.max(wait, math.ceil((1 - tokens) * 1000 / rate))
+	end
+	buckets[i] = {tokens, burst, rate}
+end
+for i, key in ipairs(KEYS) do
+	local tokens, burst, rate = unpack(buckets[i])
+	if wait == 0 then
+		tokens = tokens - 1
+	end
+	redis.call('HMSET', key, 'tokens', tostring(tokens), 'last', now)
+	redis.call('PEXPIRE', key, math.ceil(burst * 1000 / rate) + 1000)
+end
+return wait
+`
+
+// RedisLimitStore keeps the buckets in redis
+// shared by the service instances. The time of
+// instance is used, so the clocks of instances
+// should be synchronized. The short timeout
+// keeps the requests fast when redis is down,
+// the limiter then allows them.
+type RedisLimitStore struct {
+	prefix string
+	pool   *redisPool
+}
+
+func NewRedisLimitStore(addr, prefix string) *RedisLimitStore {
+	return &RedisLimitStore{
+		prefix: prefix,
+		pool:   newRedisPool(addr, 16, 250*time.Millisecond),
+	}
+}
+
+func (s *RedisLimitStore) Take(limits map[string]RateLimit, now time.Time) (bool, time.Duration, error) {
+	keys := make([]string, 0)
+	args := []string{strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)}
+	for key, limit := range limits {
+		keys = append(keys, s.prefix+":"+key)
+		args = append(args, strconv.Itoa(limit.Burst), strconv.FormatFloat(limit.rate(), 'f', -1, 64))
+	}
+	command := append([]string{"EVAL", redisTakeScript, strconv.Itoa(len(keys))}, keys...)
+	reply, err := s.pool.Do(append(command, args...)...)
+	if err != nil {
+		return false, 0, err
+	}
+	wait, ok := reply.(int64)
+	if !ok {
+		return false, 0, errRedisProtocol
+	}
+	return wait == 0, time.Duration(wait) * time.Millisecond, nil
+}
+
+// Limiter applies the rate limits of routes
+// to the client and address of request. The
+// address limit is multiplied, as many clients
+// share the address of conference network.
+type Limiter struct {
+	store    LimitStore
+	limits   map[string]RateLimit
+	ipFactor int
+	proxies  []*net.IPNet
+}
+
+func NewLimiter(store LimitStore, cfg *RateConfig) (*Limiter, error) {
+	proxies, err := parseProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	limiter := &Limiter{
+		store:    store,
+		limits:   make(map[string]RateLimit),
+		ipFactor: cfg.IPFactor,
+		proxies:  proxies,
+	}
+	for route, spec := range map[string]string{RouteQuestion: cfg.Question, RouteVote: cfg.Vote} {
+		limit, err := ParseRateLimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		limiter.limits[route] = limit
+	}
+	return limiter, nil
+}
+
+// limitOf returns the limit of route,
+// the event limits override the default
+func (l *Limiter) limitOf(route string, event *Event) RateLimit {
+	if event != nil {
+		if spec, ok := event.RateLimits[route]; ok {
+			if limit, err := ParseRateLimit(spec); err == nil {
+				return limit
+			}
+		}
+	}
+	return l.limits[route]
+}
+
+// Allow takes the tokens of client and address
+// for the route of event, none is taken unless
+// both buckets have one. It returns the wait
+// for next request if refused. The request is
+// allowed when the store fails.
+func (l *Limiter) Allow(route, eventToken, client, addr string) (bool, time.Duration) {
+	var event *Event
+	if len(eventToken) > 0 {
+		if e, err := mongo.EventByToken(eventToken); err == nil {
+			event = e
+		}
+	}
+	limit := l.limitOf(route, event)
+	keys := map[string]RateLimit{}
+	if len(client) > 0 {
+		keys[route+":"+eventToken+":client:"+client] = limit
+	}
+	if len(addr) > 0 {
+		keys[route+":"+eventToken+":addr:"+addr] = RateLimit{limit.Burst * l.ipFactor, limit.Period}
+	}
+	if len(keys) == 0 {
+		return true, 0
+	}
+	ok, wait, err := l.store.Take(keys, time.Now())
+	if err != nil {
+		log.Errorf("Allow: rate limit store failed %v", err)
+		return true, 0
+	}
+	return ok, wait
+}
+
+// parseProxies parses the comma separated
+// addresses and networks of trusted proxies
+func parseProxies(spec string) ([]*net.IPNet, error) {
+	proxies := make([]*net.IPNet, 0)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid trusted proxy %s", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusted reports whether the
+// address is of trusted proxy
+func (l *Limiter) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range l.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrOf returns the address of client. The
+// forwarded header is read only when the peer
+// is trusted proxy, from the rightmost hop, as
+// the hops left of the last trusted proxy are
+// set by the client.
+func (l *Limiter) addrOf(r *http.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	if !l.trusted(addr) {
+		return addr
+	}
+	hops := strings.Split(r.Header.Get(ForwardedForHeader), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if len(hop) == 0 {
+			continue
+		}
+		if !l.trusted(hop) {
+			return hop
+		}
+		addr = hop
+	}
+	return addr
+}
+
+// clientAddr returns the address of
+// client seen by the limiter
+func clientAddr(c *gin.Context) string {
+	if limiter == nil {
+		return (&Limiter{}).addrOf(c.Request)
+	}
+	return limiter.addrOf(c.Request)
+}
+
+// retryAfter returns the wait in whole
+// seconds for the Retry-After header
+func retryAfter(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// rateLimit creates the middleware limiting
+// the route, the eventOf returns the event
+// token of request for the event limits
+func rateLimit(route string, eventOf func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		ok, wait := limiter.Allow(route, eventOf(c), clientID(c), clientAddr(c))
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(retryAfter(wait)))
+			c.JSON(http.StatusTooManyRequests, "Rate limit exceeded")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// postedEvent returns the event token of posted
+// question, the body is restored for the handler.
+// The body over maxPostedBody is cut, so the
+// handler refuses it as malformed.
+func postedEvent(c *gin.Context) string {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPostedBody))
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	question := &Question{}
+	json.Unmarshal(body, question)
+	return question.EventToken
+}
+
+// votedEvent returns the event
+// token of the voted question
+func votedEvent(c *gin.Context) string {
+	questionID := c.Params.ByName("questionID")
+	if !bson.IsObjectIdHex(questionID) {
+		return ""
+	}
+	q, err := mongo.QuestionById(questionID)
+	if err != nil {
+		return ""
+	}
+	return q.EventToken
+}
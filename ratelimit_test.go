@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit("5/1m")
+	if err != nil || limit.Burst != 5 || limit.Period != time.Minute {
+		t.Errorf("Unexpected limit %v %v", limit, err)
+	}
+	for _, spec := range []string{"", "5", "0/1m", "5/minute", "x/1m"} {
+		if _, err := ParseRateLimit(spec); err == nil {
+			t.Errorf("Invalid limit %q accepted", spec)
+		}
+	}
+}
+
+func TestMemoryLimitStore(t *testing.T) {
+	store := NewMemoryLimitStore()
+	limit := RateLimit{2, 2 * time.Second}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := store.Take(map[string]RateLimit{"client1": limit}, now); !ok {
+			t.Error("Burst not allowed")
+		}
+	}
+	ok, wait, _ := store.Take(map[string]RateLimit{"client1": limit}, now)
+	if ok || wait != time.Second {
+		t.Errorf("Empty bucket allowed %v %v", ok, wait)
+	}
+	if ok, _, _ := store.Take(map[string]RateLimit{"client2": limit}, now); !ok {
+		t.Error("Bucket shared by clients")
+	}
+	if ok, _, _ := store.Take(map[string]RateLimit{"client1": limit}, now.Add(time.Second)); !ok {
+		t.Error("Bucket not refilled")
+	}
+
+	// The refused take leaves
+	// the other bucket full
+	store.Take(map[string]RateLimit{"client3": {1, time.Minute}}, now)
+	if ok, _, _ := store.Take(map[string]RateLimit{"client3": {1, time.Minute}, "addr1": {1, time.Minute}}, now); ok {
+		t.Error("Empty bucket allowed with other bucket")
+	}
+	if ok, _, _ := store.Take(map[string]RateLimit{"addr1": {1, time.Minute}}, now); !ok {
+		t.Error("Token taken from bucket of refused request")
+	}
+}
+
+func TestMemoryLimitStorePrune(t *testing.T) {
+	store := NewMemoryLimitStore()
+	now := time.Now()
+	store.Take(map[string]RateLimit{"slow": {1, time.Hour}}, now)
+	for i := 0; i <= maxMemoryBuckets; i++ {
+		store.Take(map[string]RateLimit{strconv.Itoa(i): {1, time.Second}}, now)
+	}
+	// The pruning by period of the fast
+	// route keeps the slow bucket empty
+	store.Take(map[string]RateLimit{"fast": {1, time.Second}}, now.Add(time.Minute))
+	if _, ok := store.buckets["slow"]; !ok || len(store.buckets) != 2 {
+		t.Errorf("Unexpected buckets after prune %d", len(store.buckets))
+	}
+	if ok, _, _ := store.Take(map[string]RateLimit{"slow": {1, time.Hour}}, now.Add(time.Minute)); ok {
+		t.Error("Empty bucket pruned by other period")
+	}
+}
+
+func TestRateLimitedRoutes(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+	var err error
+	limiter, err = NewLimiter(NewMemoryLimitStore(), &RateConfig{Question: "2/1m", Vote: "60/1m", IPFactor: 2, TrustedProxies: "192.0.2.1, 10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { limiter = nil }()
+
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	generous := &Event{Name: "Generous", RateLimits: map[string]string{RouteQuestion: "3/1m"}, Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	storage.InsertEvent(generous)
+
+	post := func(e *Event, client, addr, text string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(&Question{EventToken: e.EventToken, SessionToken: e.Sessions[0].SessionToken, Question: text})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/question", bytes.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:4321"
+		req.Header.Set(ClientHeader, client)
+		// The leftmost hop is set by client
+		req.Header.Set(ForwardedForHeader, client+", "+addr+", 10.0.0.1")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	questions := []string{"Is Go fast?", "Will you share slides?", "Where is lunch?", "Who pays the beer?", "Why mongo?"}
+
+	for i := 0; i < 2; i++ {
+		if w := post(event, "client1", "1.2.3.4", questions[i]); w.Code != http.StatusOK {
+			t.Fatalf("Question not posted %d", w.Code)
+		}
+	}
+	w := post(event, "client1", "1.2.3.4", questions[2])
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("Client not limited %d %s", w.Code, w.Header().Get("Retry-After"))
+	}
+	// The address is limited to
+	// four questions of clients
+	post(event, "client2", "1.2.3.4", questions[2])
+	post(event, "client2", "1.2.3.4", questions[3])
+	if w := post(event, "client3", "1.2.3.4", questions[4]); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Address not limited %d", w.Code)
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := post(generous, "client1", "1.2.3.5", questions[i]); w.Code != http.StatusOK {
+			t.Errorf("Event limit not applied %d", w.Code)
+		}
+	}
+	if w := post(generous, "client1", "1.2.3.5", questions[3]); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Event limit exceeded %d", w.Code)
+	}
+
+	body, _ := json.Marshal(&Question{EventToken: generous.EventToken, SessionToken: generous.Sessions[0].SessionToken, Question: strings.Repeat("Why? ", maxPostedBody)})
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/question", bytes.NewReader(body))
+	req.Header.Set(ClientHeader, "client4")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Oversized question read %d", w.Code)
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	l, err := NewLimiter(NewMemoryLimitStore(), &RateConfig{Question: "2/1m", Vote: "60/1m", TrustedProxies: "192.0.2.1,10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		remote, forwarded, addr string
+	}{
+		{"203.0.113.7:1234", "1.2.3.4", "203.0.113.7"},
+		{"192.0.2.1:1234", "6.6.6.6, 1.2.3.4", "1.2.3.4"},
+		{"192.0.2.1:1234", "6.6.6.6, 1.2.3.4, 10.0.0.2", "1.2.3.4"},
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "10.0.0.3", "10.0.0.3"},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remote
+		req.Header.Set(ForwardedForHeader, c.forwarded)
+		if addr := l.addrOf(req); addr != c.addr {
+			t.Errorf("Address of %s %q is %s", c.remote, c.forwarded, addr)
+		}
+	}
+	if _, err := parseProxies("10.0.0.0/99"); err == nil {
+		t.Error("Invalid proxy accepted")
+	}
+}
+
+func TestRedisLimitStoreDown(t *testing.T) {
+	store := NewRedisLimitStore("127.0.0.1:1", "ratelimit")
+	limit := RateLimit{1, time.Minute}
+	if _, _, err := store.Take(map[string]RateLimit{"client1": limit}, time.Now()); err == nil {
+		t.Fatal("Take succeeded without redis")
+	}
+	// The pool fails fast
+	// after the failed dial
+	if _, _, err := store.Take(map[string]RateLimit{"client1": limit}, time.Now()); err != errRedisDown {
+		t.Errorf("Dead redis dialed again %v", err)
+	}
+	l, _ := NewLimiter(store, &RateConfig{Question: "1/1m", Vote: "1/1m"})
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow(RouteVote, "", "client1", ""); !ok {
+			t.Error("Request refused without redis")
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+)
+
+// MaxCommentLength is the largest
+// number of characters of comment
+const MaxCommentLength = 1000
+
+// ErrFeedbackClosed is returned for rating
+// of session that has not ended yet
+var ErrFeedbackClosed = errors.New("rating: session feedback is not open")
+
+// SessionRating is the rating
+// summary of session in report
+type SessionRating struct {
+	SessionToken string        `json:"sessionToken"`
+	Name         string        `json:"name"`
+	Speaker      []string      `json:"speaker"`
+	Summary      RatingSummary `json:"summary"`
+}
+
+// SpeakerRating summarizes the
+// ratings of speaker sessions
+type SpeakerRating struct {
+	SpeakerID string        `json:"speakerId"`
+	Name      string        `json:"name"`
+	Summary   RatingSummary `json:"summary"`
+}
+
+// EventRatingReport is the report of
+// event ratings per session and speaker
+type EventRatingReport struct {
+	EventToken string          `json:"eventToken"`
+	Summary    RatingSummary   `json:"summary"`
+	Sessions   []SessionRating `json:"sessions"`
+	Speakers   []SpeakerRating `json:"speakers"`
+}
+
+// SessionRatingReport is the report of
+// session with the individual ratings
+type SessionRatingReport struct {
+	SessionRating
+	Ratings []Rating `json:"ratings"`
+}
+
+// feedbackOpen reports whether the session
+// accepts ratings, it opens when the session
+// is finished or its end has passed
+func feedbackOpen(session *Session, now time.Time) bool {
+	return session.Finished || (session.To > 0 && now.Unix() >= session.To)
+}
+
+// sessionByToken returns the
+// session of event or nil
+func sessionByToken(e *Event, sessionToken string) *Session {
+	for i := range e.Sessions {
+		if e.Sessions[i].SessionToken == sessionToken {
+			return &e.Sessions[i]
+		}
+	}
+	return nil
+}
+
+func postRating(c *gin.Context) {
+	client := clientID(c)
+	if len(client) == 0 {
+		c.JSON(http.StatusBadRequest, "Client not identified")
+		return
+	}
+	rating := &Rating{}
+	if err := c.BindJSON(rating); err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusBadRequest, "Cannot parse the rating")
+		return
+	}
+	rating.EventToken = c.Params.ByName("eventtoken")
+	rating.SessionToken = c.Params.ByName("session")
+	rating.Client = client
+	switch err := rateSession(rating); err {
+	case nil:
+		c.JSON(http.StatusOK, rating)
+	case mgo.ErrNotFound:
+		c.JSON(http.StatusNotFound, "Event not exist")
+	case ErrAlreadyRated, ErrFeedbackClosed:
+		c.JSON(http.StatusConflict, err.Error())
+	default:
+		if _, ok := err.(*ValidationError); ok {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot store the rating")
+	}
+}
+
+// rateSession validates and stores the
+// rating of session open for feedback
+func rateSession(rating *Rating) error {
+	event, err := mongo.EventByToken(rating.EventToken)
+	if err != nil {
+		return err
+	}
+	rating.Comment = strings.TrimSpace(rating.Comment)
+	if err := ValidateRating(rating, event); err != nil {
+		return err
+	}
+	now := time.Now()
+	if !feedbackOpen(sessionByToken(event, rating.SessionToken), now) {
+		return ErrFeedbackClosed
+	}
+	rating.RateTime = now.Unix()
+	return mongo.InsertRating(rating)
+}
+
+func getEventRatings(c *gin.Context) {
+	event := ownedEvent(c, c.Params.ByName("eventtoken"))
+	if event == nil {
+		return
+	}
+	report, err := eventRatingReport(event)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load ratings")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func getSessionRatings(c *gin.Context) {
+	event := ownedEvent(c, c.Params.ByName("eventtoken"))
+	if event == nil {
+		return
+	}
+	session := sessionByToken(event, c.Params.ByName("session"))
+	if session == nil {
+		c.JSON(http.StatusNotFound, "Session not exist")
+		return
+	}
+	ratings, err := mongo.RatingsBySession(event.EventToken, session.SessionToken)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load ratings")
+		return
+	}
+	report := &SessionRatingReport{
+		SessionRating: SessionRating{
+			SessionToken: session.SessionToken,
+			Name:         session.Name,
+			Speaker:      session.Speaker,
+		},
+		Ratings: ratings,
+	}
+	for _, r := range ratings {
+		rated := &RatingSummary{Count: 1, Sum: r.Stars}
+		rated.Stars[r.Stars-1] = 1
+		report.Summary.add(rated)
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// eventRatingReport joins the storage summaries
+// of sessions with the event, the speaker summary
+// counts the ratings of all speaker sessions
+func eventRatingReport(event *Event) (*EventRatingReport, error) {
+	summaries, err := mongo.RatingSummaries(event.EventToken)
+	if err != nil {
+		return nil, err
+	}
+	bySession := make(map[string]*RatingSummary)
+	for i := range summaries {
+		bySession[summaries[i].SessionToken] = &summaries[i]
+	}
+	report := &EventRatingReport{
+		EventToken: event.EventToken,
+		Sessions:   make([]SessionRating, 0, len(event.Sessions)),
+		Speakers:   make([]SpeakerRating, 0, len(event.Speakers)),
+	}
+	bySpeaker := make(map[string]*RatingSummary)
+	for _, speakerID := range event.Speakers {
+		bySpeaker[speakerID] = &RatingSummary{}
+	}
+	for _, session := range event.Sessions {
+		rated := SessionRating{
+			SessionToken: session.SessionToken,
+			Name:         session.Name,
+			Speaker:      session.Speaker,
+		}
+		if summary, ok := bySession[session.SessionToken]; ok {
+			rated.Summary.add(summary)
+		}
+		report.Summary.add(&rated.Summary)
+		for _, speakerID := range session.Speaker {
+			if summary, ok := bySpeaker[speakerID]; ok {
+				summary.add(&rated.Summary)
+			}
+		}
+		report.Sessions = append(report.Sessions, rated)
+	}
+	names := make(map[string]string)
+	if speakers, err := mongo.SpeakersById(event.Speakers); err == nil {
+		for _, s := range speakers {
+			names[s.ID.Hex()] = strings.TrimSpace(s.FirstName + " " + s.LastName)
+		}
+	}
+	for _, speakerID := range event.Speakers {
+		report.Speakers = append(report.Speakers, SpeakerRating{
+			SpeakerID: speakerID,
+			Name:      names[speakerID],
+			Summary:   *bySpeaker[speakerID],
+		})
+	}
+	return report, nil
+}
+
+// notifyFeedbackOpen notifies the subscribers of
+// sessions finished by the event update that
+// the session is open for ratings
+func notifyFeedbackOpen(previous, event *Event) {
+	for _, session := range event.Sessions {
+		if !session.Finished {
+			continue
+		}
+		if previous != nil {
+			if before := sessionByToken(previous, session.SessionToken); before != nil && before.Finished {
+				continue
+			}
+		}
+		if err := notifyChange(event.EventToken, session.SessionToken, MsgFeedbackOpen, session); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// feedbackPump notifies the subscribers of
+// sessions whose end passed since the last
+// tick that the session is open for ratings.
+// Only the events with local audience are
+// checked and the message is delivered by the
+// local notifier, as every instance runs
+// its own pump.
+func feedbackPump(manager EventManager, local Notifier, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	since := time.Now().Unix()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		now := time.Now().Unix()
+		for eventToken := range eventAudiences(manager.Audiences()) {
+			event, err := mongo.EventByToken(eventToken)
+			if err != nil {
+				log.Errorf("feedbackPump: cannot load event %v", err)
+				continue
+			}
+			for _, session := range event.Sessions {
+				// The finished sessions were
+				// notified by the event update
+				if session.Finished || session.To <= since || session.To > now {
+					continue
+				}
+				local.Broadcast(&Message{
+					Type:         MsgFeedbackOpen,
+					EventToken:   eventToken,
+					SessionToken: session.SessionToken,
+					Data:         session,
+				})
+			}
+		}
+		since = now
+	}
+}
+
+// ratedEvent returns the event
+// token of the rated session
+func ratedEvent(c *gin.Context) string {
+	return c.Params.ByName("eventtoken")
+}
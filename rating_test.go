@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionRatings(t *testing.T) {
+	storage := setupMemoryBackend()
+	router := setupRouter()
+
+	speaker := &Speaker{FirstName: "Ada", LastName: "Lovelace"}
+	storage.InsertSpeaker(speaker)
+	now := time.Now()
+	event := &Event{
+		Name:     "Open Zlin",
+		Speakers: []string{speaker.ID.Hex()},
+		Sessions: []Session{
+			{Name: "Intro", Speaker: []string{speaker.ID.Hex()}, From: now.Add(-2 * time.Hour).Unix(), To: now.Add(-time.Hour).Unix()},
+			{Name: "Keynote", Speaker: []string{speaker.ID.Hex()}, From: now.Unix(), To: now.Add(time.Hour).Unix()},
+		},
+	}
+	storage.InsertEvent(event)
+	intro := event.Sessions[0].SessionToken
+	keynote := event.Sessions[1].SessionToken
+
+	rate := func(client, session string, stars int) int {
+		body, _ := json.Marshal(&Rating{Stars: stars, Comment: "Nice"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/rating/"+event.EventToken+"/"+session, bytes.NewReader(body))
+		req.Header.Set(ClientHeader, client)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := rate("client1", intro, 6); code != http.StatusBadRequest {
+		t.Errorf("Invalid stars accepted %d", code)
+	}
+	if code := rate("client1", intro, 5); code != http.StatusOK {
+		t.Errorf("Rating not accepted %d", code)
+	}
+	if code := rate("client1", intro, 4); code != http.StatusConflict {
+		t.Errorf("Client rated twice %d", code)
+	}
+	rate("client2", intro, 3)
+	if code := rate("client1", keynote, 4); code != http.StatusConflict {
+		t.Errorf("Running session rated %d", code)
+	}
+
+	client := addIdleClient(commMan.(*MapEventManager), event.EventToken, keynote)
+	previous, _ := storage.EventByToken(event.EventToken)
+	event.Sessions[1].Finished = true
+	storage.UpdateEvent(event)
+	notifyFeedbackOpen(previous, event)
+	if len(client.queue) != 1 {
+		t.Fatal("Finished session not broadcast")
+	}
+	msg := &Message{}
+	json.Unmarshal(<-client.queue, msg)
+	if msg.Type != MsgFeedbackOpen {
+		t.Errorf("Unexpected message %v", msg)
+	}
+	if code := rate("client1", keynote, 4); code != http.StatusOK {
+		t.Errorf("Finished session not rated %d", code)
+	}
+
+	report, err := eventRatingReport(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Summary.Count != 3 || report.Summary.Average != 4 || report.Summary.Stars != [5]int{0, 0, 1, 1, 1} {
+		t.Errorf("Unexpected event summary %v", report.Summary)
+	}
+	if len(report.Sessions) != 2 || report.Sessions[0].Summary.Count != 2 || report.Sessions[1].Summary.Average != 4 {
+		t.Errorf("Unexpected session summaries %v", report.Sessions)
+	}
+	if len(report.Speakers) != 1 || report.Speakers[0].Name != "Ada Lovelace" || report.Speakers[0].Summary.Count != 3 {
+		t.Errorf("Unexpected speaker summaries %v", report.Speakers)
+	}
+}
+
+func TestFeedbackPump(t *testing.T) {
+	storage := setupMemoryBackend()
+	manager := commMan.(*MapEventManager)
+	end := time.Now().Unix() + 1
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro", To: end}, {Name: "Keynote", To: end + 3600}}}
+	storage.InsertEvent(event)
+	ending := addIdleClient(manager, event.EventToken, event.Sessions[0].SessionToken)
+	running := addIdleClient(manager, event.EventToken, event.Sessions[1].SessionToken)
+
+	// The pump is stopped before the next
+	// test replaces the storage
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		feedbackPump(manager, manager, 50*time.Millisecond, done)
+		close(stopped)
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	select {
+	case data := <-ending.queue:
+		msg := &Message{}
+		json.Unmarshal(data, msg)
+		if msg.Type != MsgFeedbackOpen || msg.Seq != 1 {
+			t.Errorf("Unexpected message %v", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Feedback not opened at the session end")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if len(ending.queue) != 0 || len(running.queue) != 0 {
+		t.Error("Feedback opened more than once or before the session end")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// redisError is the error
+// reply of redis server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+var errRedisProtocol = errors.New("redis: malformed reply")
+
+var errRedisDown = errors.New("redis: server unavailable")
+
+// redisRetryDelay is the time the pool
+// fails fast after the dial failed
+const redisRetryDelay = time.Second
+
+// redisPool keeps the idle connections of
+// redis server. The connections are dialed
+// without holding the lock, after the failed
+// dial the pool fails fast for a while, so
+// the callers are not blocked by the dead
+// server.
+type redisPool struct {
+	*sync.Mutex
+	addr    string
+	timeout time.Duration
+	idle    chan *redisConn
+	retryAt time.Time
+	closed  bool
+}
+
+func newRedisPool(addr string, size int, timeout time.Duration) *redisPool {
+	return &redisPool{
+		Mutex:   &sync.Mutex{},
+		addr:    addr,
+		timeout: timeout,
+		idle:    make(chan *redisConn, size),
+	}
+}
+
+// Do sends the command over idle or newly
+// dialed connection, the connection is
+// dropped if it failed
+func (p *redisPool) Do(args ...string) (interface{}, error) {
+	conn, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	conn.conn.SetDeadline(time.Now().Add(p.timeout))
+	reply, err := conn.Do(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		conn.Close()
+		return nil, err
+	}
+	p.put(conn)
+	return reply, err
+}
+
+func (p *redisPool) get() (*redisConn, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+	}
+	p.Lock()
+	closed, down := p.closed, time.Now().Before(p.retryAt)
+	p.Unlock()
+	if closed {
+		return nil, ErrBrokerClosed
+	}
+	if down {
+		return nil, errRedisDown
+	}
+	conn, err := dialRedis(p.addr, p.timeout)
+	if err != nil {
+		p.Lock()
+		p.retryAt = time.Now().Add(redisRetryDelay)
+		p.Unlock()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (p *redisPool) put(conn *redisConn) {
+	p.Lock()
+	closed := p.closed
+	p.Unlock()
+	if closed {
+		conn.Close()
+		return
+	}
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Close closes the idle connections,
+// the connections in use are closed
+// when returned
+func (p *redisPool) Close() error {
+	p.Lock()
+	p.closed = true
+	p.Unlock()
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// redisConn is minimal client of
+// redis serialization protocol
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialRedis(addr string, timeout time.Duration) (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &redisConn{conn, bufio.NewReader(conn)}, nil
+}
+
+// Do sends the command and
+// waits for its reply
+func (c *redisConn) Do(args ...string) (interface{}, error) {
+	if err := c.Send(args...); err != nil {
+		return nil, err
+	}
+	reply, err := c.Receive()
+	if err != nil {
+		return nil, err
+	}
+	if rErr, ok := reply.(redisError); ok {
+		return nil, rErr
+	}
+	return reply, nil
+}
+
+func (c *redisConn) Send(args ...string) error {
+	return writeRedisCommand(c.conn, args...)
+}
+
+// Receive reads the next reply, the reply is
+// string, int64, []interface{}, redisError or
+// nil for null bulk string.
+func (c *redisConn) Receive() (interface{}, error) {
+	return readRedisReply(c.r)
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+func writeRedisCommand(w io.Writer, args ...string) error {
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errRedisProtocol
+	}
+	payload := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return redisError(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, errRedisProtocol
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTopQuestions is the number
+// of top questions in reports
+const DefaultTopQuestions = 5
+
+// ActivityReport are the totals of
+// questions and participation
+type ActivityReport struct {
+	Questions     int     `json:"questions"`
+	Votes         int     `json:"votes"`
+	Answered      int     `json:"answered"`
+	AnsweredRatio float64 `json:"answeredRatio"`
+	Participants  int     `json:"participants"`
+	// PeakSockets is the largest number of
+	// connections of single instance, the
+	// sockets of other instances behind the
+	// broker are not added to it
+	PeakSockets  int        `json:"peakSockets"`
+	PeakTime     int64      `json:"peakTime,omitempty"`
+	TopQuestions []Question `json:"topQuestions"`
+}
+
+// SessionReport is the activity of session
+type SessionReport struct {
+	SessionToken string `json:"sessionToken"`
+	Name         string `json:"name"`
+	Room         string `json:"room"`
+	ActivityReport
+}
+
+// EventReport is the activity of event
+// with the reports of its sessions
+type EventReport struct {
+	EventToken string `json:"eventToken"`
+	Name       string `json:"name"`
+	ActivityReport
+	Sessions []SessionReport `json:"sessions"`
+}
+
+// add counts the activity of session
+func (r *ActivityReport) add(activity *SessionActivity) {
+	r.Questions += activity.Questions
+	r.Votes += activity.Votes
+	r.Answered += activity.Answered
+	if r.Questions > 0 {
+		r.AnsweredRatio = float64(r.Answered) / float64(r.Questions)
+	}
+}
+
+func getEventReport(c *gin.Context) {
+	top, ok := reportTop(c)
+	if !ok {
+		return
+	}
+	event := ownedEvent(c, c.Params.ByName("eventtoken"))
+	if event == nil {
+		return
+	}
+	report, err := eventReport(event, top)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot create the report")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func getSessionReport(c *gin.Context) {
+	top, ok := reportTop(c)
+	if !ok {
+		return
+	}
+	event := ownedEvent(c, c.Params.ByName("eventtoken"))
+	if event == nil {
+		return
+	}
+	report, err := eventReport(event, top)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot create the report")
+		return
+	}
+	sessionToken := c.Params.ByName("session")
+	for _, session := range report.Sessions {
+		if session.SessionToken == sessionToken {
+			c.JSON(http.StatusOK, session)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, "Session not exist")
+}
+
+// reportTop parses the number of top
+// questions, the invalid value is refused
+func reportTop(c *gin.Context) (int, bool) {
+	top, err := strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(DefaultTopQuestions)))
+	if err != nil || top < 0 || top > questionCfg.MaxPageSize {
+		c.JSON(http.StatusBadRequest, "Invalid top")
+		return 0, false
+	}
+	return top, true
+}
+
+// eventReport joins the storage aggregations of
+// event sessions. The top questions of event are
+// the best of the top questions of sessions.
+func eventReport(event *Event, top int) (*EventReport, error) {
+	activities, err := mongo.SessionActivities(event.EventToken)
+	if err != nil {
+		return nil, err
+	}
+	participants, total, err := mongo.Participants(event.EventToken)
+	if err != nil {
+		return nil, err
+	}
+	peaks, err := mongo.SessionPeaks(event.EventToken)
+	if err != nil {
+		return nil, err
+	}
+	bySession := make(map[string]*SessionActivity)
+	for i := range activities {
+		bySession[activities[i].SessionToken] = &activities[i]
+	}
+	sessionClients := make(map[string]int)
+	for _, p := range participants {
+		sessionClients[p.SessionToken] = p.Participants
+	}
+	peakOf := make(map[string]SessionPeak)
+	for _, p := range peaks {
+		peakOf[p.SessionToken] = p
+	}
+
+	report := &EventReport{
+		EventToken: event.EventToken,
+		Name:       event.Name,
+		Sessions:   make([]SessionReport, 0, len(event.Sessions)),
+	}
+	report.Participants = total
+	report.PeakSockets = peakOf[""].Peak
+	report.PeakTime = peakOf[""].PeakTime
+	best := make([]Question, 0)
+	for _, session := range event.Sessions {
+		s := SessionReport{
+			SessionToken: session.SessionToken,
+			Name:         session.Name,
+			Room:         session.Room,
+		}
+		if activity, ok := bySession[session.SessionToken]; ok {
+			s.add(activity)
+			report.add(activity)
+		}
+		s.Participants = sessionClients[session.SessionToken]
+		s.PeakSockets = peakOf[session.SessionToken].Peak
+		s.PeakTime = peakOf[session.SessionToken].PeakTime
+		s.TopQuestions = make([]Question, 0)
+		if top > 0 && s.Questions > 0 {
+			page, err := mongo.QuestionsPage(&QuestionQuery{
+				EventToken:   event.EventToken,
+				SessionToken: session.SessionToken,
+				Sort:         SortTop,
+				Limit:        top,
+			})
+			if err != nil {
+				return nil, err
+			}
+			s.TopQuestions = page.Questions
+			best = append(best, page.Questions...)
+		}
+		report.Sessions = append(report.Sessions, s)
+	}
+	sort.Sort(byTop(best))
+	if len(best) > top {
+		best = best[:top]
+	}
+	report.TopQuestions = best
+	return report, nil
+}
+
+// peakPump records the peaks of concurrent
+// connections of sessions and events, the
+// storage is written only when the peak
+// seen by the instance rises. The counts are
+// of local manager only, with several
+// instances the stored peak is the largest
+// of the instances, not their sum.
+func peakPump(manager EventManager, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	recorded := make(map[string]int)
+	record := func(eventToken, sessionToken string, count int, now int64) {
+		key := eventToken + "/" + sessionToken
+		if count <= recorded[key] {
+			return
+		}
+		if err := mongo.RecordPeak(eventToken, sessionToken, count, now); err != nil {
+			log.Errorf("peakPump: cannot record peak %v", err)
+			return
+		}
+		recorded[key] = count
+	}
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		now := time.Now().Unix()
+		for eventToken, audience := range eventAudiences(manager.Audiences()) {
+			for sessionToken, count := range audience.Sessions {
+				record(eventToken, sessionToken, count, now)
+			}
+			record(eventToken, "", audience.Total, now)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEventReport(t *testing.T) {
+	storage := setupMemoryBackend()
+	manager := commMan.(*MapEventManager)
+
+	event := &Event{Name: "Open Zlin", CreatedBy: "ann@example.com", Sessions: []Session{{Name: "Intro", Room: "A"}, {Name: "Keynote", Room: "B"}}}
+	storage.InsertEvent(event)
+	intro := event.Sessions[0].SessionToken
+	keynote := event.Sessions[1].SessionToken
+
+	post := func(session, client, text string) *Question {
+		q := &Question{EventToken: event.EventToken, SessionToken: session, Question: text, Client: client}
+		if err := createQuestion(q); err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}
+	first := post(intro, "client1", "How fast is it?")
+	second := post(intro, "client2", "Does it scale?")
+	third := post(keynote, "client1", "When is the release?")
+	castVote(first.ID.Hex(), "client3", OperationUpvote)
+	castVote(first.ID.Hex(), "client2", OperationUpvote)
+	castVote(third.ID.Hex(), "client3", OperationUpvote)
+	changeQuestionState(second.ID.Hex(), StateAnswered)
+
+	for i := 0; i < 3; i++ {
+		addIdleClient(manager, event.EventToken, intro)
+	}
+	addIdleClient(manager, event.EventToken, keynote)
+	addIdleClient(manager, event.EventToken, ModerationSession)
+	done := make(chan struct{})
+	go peakPump(manager, 10*time.Millisecond, done)
+	recorded := waitFor(func() bool {
+		peaks, _ := storage.SessionPeaks(event.EventToken)
+		return len(peaks) == 3
+	})
+	close(done)
+	if !recorded {
+		t.Fatal("Peaks not recorded")
+	}
+
+	report, err := eventReport(event, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Questions != 3 || report.Votes != 3 || report.Participants != 3 || report.PeakSockets != 4 {
+		t.Errorf("Unexpected event report %v", report.ActivityReport)
+	}
+	if len(report.TopQuestions) != 1 || report.TopQuestions[0].ID != first.ID {
+		t.Errorf("Unexpected top questions %v", report.TopQuestions)
+	}
+	session := report.Sessions[0]
+	if session.Questions != 2 || session.Answered != 1 || session.AnsweredRatio != 0.5 ||
+		session.Participants != 3 || session.PeakSockets != 3 || session.Room != "A" {
+		t.Errorf("Unexpected session report %v", session)
+	}
+	if report.Sessions[1].Participants != 2 || report.Sessions[1].PeakSockets != 1 {
+		t.Errorf("Unexpected session report %v", report.Sessions[1])
+	}
+
+	router := gin.New()
+	router.GET("/report/:eventtoken/:session", organizer("ann@example.com"), getSessionReport)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/report/"+event.EventToken+"/"+keynote+"?top=50", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Session report not served %d", w.Code)
+	}
+	served := &SessionReport{}
+	json.Unmarshal(w.Body.Bytes(), served)
+	if served.SessionToken != keynote || len(served.TopQuestions) != 1 {
+		t.Errorf("Unexpected served report %v", served)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gopkg.in/mgo.v2"
+)
+
+// readPump reads from the websocket connection
+// until the peer disconnects or stops answering
+// pings. The connection is then removed from
+// manager and closed.
+func readPump(sub *Subscription, conn *websocket.Conn, cfg WsConfig) {
+	defer func() {
+		commMan.RemoveConnection(sub.EventToken, sub.SessionToken, conn)
+		conn.Close()
+	}()
+	conn.SetReadLimit(cfg.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Errorf("readPump: connection for %s/%s closed %v", sub.EventToken, sub.SessionToken, err)
+			}
+			return
+		}
+		handleSocketMessage(sub, data)
+	}
+}
+
+// handleSocketMessage processes the request
+// received from client and replies to it
+func handleSocketMessage(sub *Subscription, data []byte) {
+	req := &Request{}
+	if err := json.Unmarshal(data, req); err != nil {
+		log.Errorf("handleSocketMessage: malformed message %v", err)
+		replyError(sub, req, CodeMalformed, err)
+		return
+	}
+	switch req.Type {
+	case MsgSnapshotRequest:
+		if len(req.Data) > 0 {
+			snapshotReq := &SnapshotRequest{}
+			if err := json.Unmarshal(req.Data, snapshotReq); err != nil {
+				replyError(sub, req, CodeMalformed, err)
+				return
+			}
+			if !ValidSort(snapshotReq.Sort) {
+				replyError(sub, req, CodeInvalid, fmt.Errorf("Unknown sort mode %s", snapshotReq.Sort))
+				return
+			}
+			// The mode is kept for
+			// the following snapshots
+			sub.Sort = snapshotReq.Sort
+		}
+		if err := notifyChangeForConnection(sub); err != nil {
+			log.Errorln(err)
+		}
+	case MsgPostQuestion:
+		if !allowRequest(sub, req, RouteQuestion) {
+			return
+		}
+		question := &Question{}
+		if err := json.Unmarshal(req.Data, question); err != nil {
+			replyError(sub, req, CodeMalformed, err)
+			return
+		}
+		// The question can be posted
+		// only to session of socket
+		question.EventToken = sub.EventToken
+		question.SessionToken = sub.SessionToken
+		question.Client = sub.Client
+		err := createQuestion(question)
+		if dupErr, ok := err.(*DuplicateError); ok {
+			// The duplicates are sent so the
+			// client can offer voting for them
+			sendReply(sub, &Reply{
+				Type:    MsgError,
+				ReplyTo: req.ID,
+				Data:    dupErr.Duplicates,
+				Error:   &ReplyError{CodeDuplicate, dupErr.Error()},
+			})
+			return
+		}
+		if contentErr, ok := err.(*ContentError); ok {
+			sendReply(sub, &Reply{
+				Type:    MsgError,
+				ReplyTo: req.ID,
+				Data:    contentErr.Violations,
+				Error:   &ReplyError{CodeContentRefused, contentErr.Error()},
+			})
+			return
+		}
+		if err != nil {
+			replyStorageError(sub, req, err)
+			return
+		}
+		reply(sub, req, question)
+	case MsgPollVote:
+		if len(sub.Client) == 0 {
+			replyError(sub, req, CodeNotIdentified, errors.New("Client not identified"))
+			return
+		}
+		if !allowRequest(sub, req, RouteVote) {
+			return
+		}
+		vote := &PollVote{}
+		if err := json.Unmarshal(req.Data, vote); err != nil {
+			replyError(sub, req, CodeMalformed, err)
+			return
+		}
+		poll, err := castPollVote(vote.ID.Hex(), sub.Client, vote.Choices)
+		if err != nil {
+			replyStorageError(sub, req, err)
+			return
+		}
+		reply(sub, req, poll)
+	case MsgPromptResponse:
+		if len(sub.Client) == 0 {
+			replyError(sub, req, CodeNotIdentified, errors.New("Client not identified"))
+			return
+		}
+		if !allowRequest(sub, req, RouteVote) {
+			return
+		}
+		answer := &PromptAnswer{}
+		if err := json.Unmarshal(req.Data, answer); err != nil {
+			replyError(sub, req, CodeMalformed, err)
+			return
+		}
+		prompt, err := addPromptResponse(answer.ID.Hex(), sub.Client, answer.Text)
+		if contentErr, ok := err.(*ContentError); ok {
+			sendReply(sub, &Reply{
+				Type:    MsgError,
+				ReplyTo: req.ID,
+				Data:    contentErr.Violations,
+				Error:   &ReplyError{CodeContentRefused, contentErr.Error()},
+			})
+			return
+		}
+		if err != nil {
+			replyStorageError(sub, req, err)
+			return
+		}
+		reply(sub, req, withCloud(prompt))
+	case MsgVote, MsgUnvote:
+		if len(sub.Client) == 0 {
+			replyError(sub, req, CodeNotIdentified, errors.New("Client not identified"))
+			return
+		}
+		if !allowRequest(sub, req, RouteVote) {
+			return
+		}
+		ref := &QuestionRef{}
+		if err := json.Unmarshal(req.Data, ref); err != nil {
+			replyError(sub, req, CodeMalformed, err)
+			return
+		}
+		operation := OperationUpvote
+		if req.Type == MsgUnvote {
+			operation = OperationRetract
+		}
+		q, err := castVote(ref.ID.Hex(), sub.Client, operation)
+		if err != nil {
+			replyStorageError(sub, req, err)
+			return
+		}
+		reply(sub, req, &QuestionRef{q.ID, q.Vote})
+	default:
+		log.Errorf("handleSocketMessage: unknown message type %s", req.Type)
+		replyError(sub, req, CodeUnknownType, fmt.Errorf("Unknown message type %s", req.Type))
+	}
+}
+
+// allowRequest applies the rate limit of route
+// to the socket client, the refused request
+// is replied with error
+func allowRequest(sub *Subscription, req *Request, route string) bool {
+	if limiter == nil {
+		return true
+	}
+	ok, wait := limiter.Allow(route, sub.EventToken, sub.Client, sub.Addr)
+	if !ok {
+		replyError(sub, req, CodeRateLimited, fmt.Errorf("Rate limit exceeded, retry after %d s", retryAfter(wait)))
+	}
+	return ok
+}
+
+func reply(sub *Subscription, req *Request, data interface{}) {
+	sendReply(sub, &Reply{
+		Type:    MsgReply,
+		ReplyTo: req.ID,
+		Data:    data,
+	})
+}
+
+func replyError(sub *Subscription, req *Request, code string, err error) {
+	sendReply(sub, &Reply{
+		Type:    MsgError,
+		ReplyTo: req.ID,
+		Error:   &ReplyError{code, err.Error()},
+	})
+}
+
+// replyStorageError replies with the error
+// code matching the error of storage
+func replyStorageError(sub *Subscription, req *Request, err error) {
+	code := CodeInternal
+	switch err {
+	case mgo.ErrNotFound:
+		code = CodeNotFound
+	case ErrAlreadyVoted:
+		code = CodeAlreadyVoted
+	case ErrNotVoted:
+		code = CodeNotVoted
+	case ErrNotAuthor:
+		code = CodeNotAuthor
+	case ErrPollClosed:
+		code = CodePollClosed
+	}
+	if _, ok := err.(*ValidationError); ok {
+		code = CodeInvalid
+	}
+	replyError(sub, req, code, err)
+}
+
+func sendReply(sub *Subscription, r *Reply) {
+	if err := commMan.Send(sub, r); err != nil {
+		log.Errorf("sendReply: cannot send reply %v", err)
+	}
+}
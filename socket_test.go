@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialEventSocket connects to the event websocket
+// of test server and waits until the connection
+// is registered in manager
+func dialEventSocket(t *testing.T, server *httptest.Server, eventToken, sessionToken string) *websocket.Conn {
+	return dialEventSocketQuery(t, server, eventToken, sessionToken, "")
+}
+
+func dialEventSocketQuery(t *testing.T, server *httptest.Server, eventToken, sessionToken, query string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/event/" + eventToken + "/" + sessionToken + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(func() bool { return len(commMan.GetConnByEventSession(eventToken, sessionToken)) > 0 }) {
+		t.Fatal("websocket not registered")
+	}
+	return conn
+}
+
+// closeEventSocket closes the client connection
+// and waits until the server read pump removes
+// it, so the next test does not race with it
+func closeEventSocket(t *testing.T, conn *websocket.Conn, eventToken, sessionToken string) {
+	conn.Close()
+	if !waitFor(func() bool { return len(commMan.GetConnByEventSession(eventToken, sessionToken)) == 0 }) {
+		t.Error("closed websocket not removed")
+	}
+}
+
+func waitFor(condition func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+func TestReadPumpRemovesClosedConnection(t *testing.T) {
+	setupMemoryBackend()
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	conn := dialEventSocket(t, server, "abcd", "1234")
+	conn.Close()
+
+	if !waitFor(func() bool { return len(commMan.GetConnByEventSession("abcd", "1234")) == 0 }) {
+		t.Error("closed websocket not removed")
+	}
+}
+
+func TestReadPumpRemovesUnresponsiveConnection(t *testing.T) {
+	original := *wsCfg
+	wsCfg.PongWait = 200 * time.Millisecond
+	wsCfg.PingPeriod = 100 * time.Millisecond
+	defer func() { *wsCfg = original }()
+	setupMemoryBackend()
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	// The client never reads so it
+	// never answers the pings
+	conn := dialEventSocket(t, server, "abcd", "1234")
+	defer conn.Close()
+
+	if !waitFor(func() bool { return len(commMan.GetConnByEventSession("abcd", "1234")) == 0 }) {
+		t.Error("unresponsive websocket not removed")
+	}
+}
+
+func TestBroadcastReachesSocket(t *testing.T) {
+	storage := setupMemoryBackend()
+	storage.InsertQuestion(&Question{EventToken: "abcd", SessionToken: "1234", Question: "first"})
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	conn := dialEventSocket(t, server, "abcd", "1234")
+	defer closeEventSocket(t, conn, "abcd", "1234")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	snapshot := struct {
+		Message
+		Data []Question `json:"data"`
+	}{}
+	if err := conn.ReadJSON(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Type != MsgSnapshot || snapshot.Seq != 0 || len(snapshot.Data) != 1 {
+		t.Errorf("Unexpected snapshot %v", snapshot)
+	}
+
+	notifyChange("abcd", "1234", MsgQuestionAdded, &Question{Question: "pushed"})
+	added := struct {
+		Message
+		Data Question `json:"data"`
+	}{}
+	if err := conn.ReadJSON(&added); err != nil {
+		t.Fatal(err)
+	}
+	if added.Type != MsgQuestionAdded || added.Seq != 1 || added.Data.Question != "pushed" {
+		t.Errorf("Unexpected broadcast %v", added)
+	}
+
+	conn.WriteJSON(&Message{Type: MsgSnapshotRequest})
+	if err := conn.ReadJSON(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Type != MsgSnapshot || snapshot.Seq != 1 {
+		t.Errorf("Unexpected requested snapshot %v", snapshot)
+	}
+}
+
+func TestSocketProtocol(t *testing.T) {
+	storage := setupMemoryBackend()
+	event := &Event{Name: "Open Zlin", Sessions: []Session{{Name: "Intro"}}}
+	storage.InsertEvent(event)
+	sessionToken := event.Sessions[0].SessionToken
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	conn := dialEventSocketQuery(t, server, event.EventToken, sessionToken, "?client=client1")
+	defer closeEventSocket(t, conn, event.EventToken, sessionToken)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	conn.ReadJSON(&Message{})
+
+	// readReply skips the broadcasts
+	// and returns the reply to request
+	readReply := func(id string) *Reply {
+		for {
+			r := &Reply{}
+			if err := conn.ReadJSON(r); err != nil {
+				t.Fatal(err)
+			}
+			if r.ReplyTo == id {
+				return r
+			}
+		}
+	}
+
+	conn.WriteJSON(&Request{Type: MsgPostQuestion, ID: "1", Data: []byte(`{"question":"Is it live?"}`)})
+	r := readReply("1")
+	posted, _ := r.Data.(map[string]interface{})
+	if r.Type != MsgReply || posted["sessionToken"] != sessionToken {
+		t.Fatalf("Unexpected reply %v", r)
+	}
+
+	vote := []byte(`{"id":"` + posted["id"].(string) + `"}`)
+	conn.WriteJSON(&Request{Type: MsgVote, ID: "2", Data: vote})
+	if r := readReply("2"); r.Type != MsgReply {
+		t.Errorf("Vote not accepted %v", r.Error)
+	}
+	conn.WriteJSON(&Request{Type: MsgVote, ID: "3", Data: vote})
+	if r := readReply("3"); r.Type != MsgError || r.Error.Code != CodeAlreadyVoted {
+		t.Errorf("Second vote not rejected %v", r)
+	}
+	conn.WriteJSON(&Request{Type: MsgPostQuestion, ID: "4", Data: []byte(`{"question":" "}`)})
+	if r := readReply("4"); r.Type != MsgError || r.Error.Code != CodeInvalid {
+		t.Errorf("Empty question not rejected %v", r)
+	}
+	conn.WriteJSON(&Request{Type: "dance", ID: "5"})
+	if r := readReply("5"); r.Type != MsgError || r.Error.Code != CodeUnknownType {
+		t.Errorf("Unknown request not rejected %v", r)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LastEventIDHeader is the header of event
+// stream reconnect with the id of last event
+const LastEventIDHeader = "Last-Event-ID"
+
+// resumePosition returns the stream and sequence
+// of the last message received by client, given
+// by query parameters or the event stream id.
+func resumePosition(c *gin.Context) (string, uint64, bool) {
+	stream, since := c.Query("stream"), c.Query("since")
+	if lastID := c.Request.Header.Get(LastEventIDHeader); len(lastID) > 0 {
+		parts := strings.SplitN(lastID, ":", 2)
+		if len(parts) == 2 {
+			stream, since = parts[0], parts[1]
+		}
+	}
+	seq, err := strconv.ParseUint(since, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return stream, seq, true
+}
+
+// subscribeClient subscribes the client to event
+// session. The client resuming from its last
+// message receives only the missed messages,
+// otherwise the snapshot is queued first.
+func subscribeClient(c *gin.Context, eventToken, sessionToken string) (*Subscription, error) {
+	sortMode := c.Query("sort")
+	if !ValidSort(sortMode) {
+		sortMode = ""
+	}
+	if stream, since, ok := resumePosition(c); ok {
+		sub, resumed := commMan.Resume(eventToken, sessionToken, stream, since)
+		sub.Sort = sortMode
+		if resumed {
+			return sub, nil
+		}
+		return sub, notifyChangeForConnection(sub)
+	}
+	sub := commMan.Subscribe(eventToken, sessionToken)
+	sub.Sort = sortMode
+	return sub, notifyChangeForConnection(sub)
+}
+
+// eventID returns the id of event stream
+// event carrying the message, the id is
+// empty for message without sequence
+func eventID(data []byte) string {
+	position := struct {
+		Seq    uint64 `json:"seq"`
+		Stream string `json:"stream"`
+	}{}
+	json.Unmarshal(data, &position)
+	if len(position.Stream) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", position.Stream, position.Seq)
+}
+
+// eventStreamHandler delivers the session messages
+// as server-sent events, each event data is the
+// same message as sent over websocket.
+func eventStreamHandler(c *gin.Context) {
+	eventToken := c.Params.ByName("eventtoken")
+	sessionToken := c.Params.ByName("session")
+	cfg := *wsCfg
+
+	sub, err := subscribeClient(c, eventToken, sessionToken)
+	defer commMan.Unsubscribe(sub)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load questions")
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(cfg.PingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case data := <-sub.Messages():
+			// The messages without sequence
+			// have no id, so the last id
+			// stays resumable
+			if id := eventID(data); len(id) > 0 {
+				_, err = fmt.Fprintf(c.Writer, "id: %s\n", id)
+			}
+			if err == nil {
+				_, err = fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			}
+		case <-ticker.C:
+			// Comment line keeps the
+			// proxies from closing stream
+			_, err = fmt.Fprint(c.Writer, ": ping\n\n")
+		case <-sub.Done():
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+		if err != nil {
+			log.Errorf("eventStreamHandler: cannot write event %v", err)
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// eventPollHandler returns the session messages
+// following the position given by stream and
+// since query parameters. The snapshot is
+// returned if the client missed too many
+// messages or did not provide the position,
+// otherwise the request waits until new
+// message or timeout.
+func eventPollHandler(c *gin.Context) {
+	eventToken := c.Params.ByName("eventtoken")
+	sessionToken := c.Params.ByName("session")
+	cfg := *wsCfg
+
+	sub, err := subscribeClient(c, eventToken, sessionToken)
+	defer commMan.Unsubscribe(sub)
+	if err != nil {
+		log.Errorln(err)
+		c.JSON(http.StatusInternalServerError, "Cannot load questions")
+		return
+	}
+
+	messages := make([]json.RawMessage, 0)
+	if len(sub.Messages()) == 0 {
+		timeout := time.NewTimer(cfg.PollTimeout)
+		defer timeout.Stop()
+		select {
+		case data := <-sub.Messages():
+			messages = append(messages, data)
+		case <-timeout.C:
+		case <-sub.Done():
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+	// Take all the queued messages
+	for drained := false; !drained; {
+		select {
+		case data := <-sub.Messages():
+			messages = append(messages, data)
+		default:
+			drained = true
+		}
+	}
+	c.JSON(http.StatusOK, messages)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	setupMemoryBackend()
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/sse/abcd/1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+	lastID := ""
+	readEvent := func() *Message {
+		msg := &Message{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "":
+				return msg
+			case strings.HasPrefix(line, "id: "):
+				lastID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), msg)
+			}
+		}
+	}
+
+	if msg := readEvent(); msg.Type != MsgSnapshot {
+		t.Errorf("Snapshot not sent first %v", msg)
+	}
+	notifyChange("abcd", "1234", MsgQuestionAdded, &Question{Question: "pushed"})
+	msg := readEvent()
+	if msg.Type != MsgQuestionAdded || msg.Seq != 1 || lastID != msg.Stream+":1" {
+		t.Errorf("Unexpected event %v with id %s", msg, lastID)
+	}
+	resp.Body.Close()
+
+	// Reconnect with the id of last event
+	notifyChange("abcd", "1234", MsgQuestionAdded, &Question{Question: "missed"})
+	req, _ := http.NewRequest("GET", server.URL+"/sse/abcd/1234", nil)
+	req.Header.Set(LastEventIDHeader, lastID)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader = bufio.NewReader(resp.Body)
+	if msg := readEvent(); msg.Type != MsgQuestionAdded || msg.Seq != 2 {
+		t.Errorf("Missed event not replayed %v", msg)
+	}
+}
+
+func TestEventPoll(t *testing.T) {
+	setupMemoryBackend()
+	router := setupRouter()
+
+	poll := func(query string) []Message {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/poll/abcd/1234"+query, nil)
+		router.ServeHTTP(w, req)
+		messages := make([]Message, 0)
+		json.Unmarshal(w.Body.Bytes(), &messages)
+		return messages
+	}
+
+	messages := poll("")
+	if len(messages) != 1 || messages[0].Type != MsgSnapshot {
+		t.Fatalf("Snapshot not returned without sequence %v", messages)
+	}
+	stream := messages[0].Stream
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		notifyChange("abcd", "1234", MsgQuestionAdded, &Question{Question: "pushed"})
+	}()
+	if messages := poll("?since=0&stream=" + stream); len(messages) != 1 || messages[0].Type != MsgQuestionAdded {
+		t.Errorf("Message not returned to waiting poll %v", messages)
+	}
+
+	notifyChange("abcd", "1234", MsgQuestionAdded, &Question{Question: "missed"})
+	if messages := poll("?since=1&stream=" + stream); len(messages) != 1 || messages[0].Seq != 2 || messages[0].Type != MsgQuestionAdded {
+		t.Errorf("Missed message not replayed %v", messages)
+	}
+	if messages := poll("?since=1&stream=other"); len(messages) != 1 || messages[0].Type != MsgSnapshot || messages[0].Seq != 2 {
+		t.Errorf("Snapshot not returned for unknown stream %v", messages)
+	}
+}
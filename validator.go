@@ -3,22 +3,164 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
+// MaxQuestionLength is the largest
+// number of characters of question
+const MaxQuestionLength = 1000
+
 var (
 	ErrDateNotInSequence              = fmt.Errorf("event validator: ToDate is before FromDate")
 	FmtErrTwoSessionsSameTimeSameRoom = "event validator: session %s overrides the previous session in same room %s"
 	FmtErrSessionDateNotInSequence    = "event validator: session %s ToDate is before FromDate"
 	FmtErrSessionRoomNotInEvent       = "event validator: session %s has defined room not defined in event"
 	FmtErrSessionSpeakerNotInEvent    = "event validator: session %s has defined speak %s not defined in event"
+	FmtErrRateLimitInvalid            = "event validator: rate limit %s has invalid value %s"
+	FmtErrContentPolicyUnknown        = "event validator: unknown content policy %s"
+	ErrQuestionEmpty                  = &ValidationError{"question validator: question text is empty"}
+	ErrQuestionTooLong                = &ValidationError{fmt.Sprintf("question validator: question text is over %d characters", MaxQuestionLength)}
+	FmtErrQuestionSessionNotInEvent   = "question validator: session %s not defined in event"
+	ErrStateInvalid                   = &ValidationError{"question validator: unknown question state"}
+	ErrCursorInvalid                  = &ValidationError{"question validator: invalid page cursor"}
+	ErrMergeEmpty                     = &ValidationError{"merge validator: no questions to merge"}
+	ErrMergeInvalid                   = &ValidationError{"merge validator: merged questions must be other questions of same session"}
+	ErrPollQuestionEmpty              = &ValidationError{"poll validator: poll question is empty"}
+	ErrPollOptions                    = &ValidationError{"poll validator: poll needs at least two non-empty options"}
+	ErrPollState                      = &ValidationError{"poll validator: state must be open or closed"}
+	ErrPollChoices                    = &ValidationError{"poll validator: choices must be distinct options of poll"}
+	ErrPollSingleChoice               = &ValidationError{"poll validator: poll accepts single choice"}
+	ErrPromptQuestionEmpty            = &ValidationError{"prompt validator: prompt question is empty"}
+	ErrPromptMaxWords                 = &ValidationError{"prompt validator: max words must be between 1 and 3"}
+	ErrResponseEmpty                  = &ValidationError{"prompt validator: response has no words"}
+	ErrResponseTooLong                = &ValidationError{"prompt validator: response has too many words"}
+	ErrRatingStars                    = &ValidationError{"rating validator: stars must be between 1 and 5"}
+	ErrRatingComment                  = &ValidationError{"rating validator: comment is too long"}
+	ErrModerationInvalid              = &ValidationError{"moderation validator: moderation must be approved or rejected"}
 )
 
+// ValidationError is the error of invalid
+// data received from client
+type ValidationError struct {
+	msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.msg
+}
+
+func ValidateQuestion(q *Question, e *Event) error {
+	if len(strings.TrimSpace(q.Question)) == 0 {
+		return ErrQuestionEmpty
+	}
+	if utf8.RuneCountInString(q.Question) > MaxQuestionLength {
+		return ErrQuestionTooLong
+	}
+	if hasSession(e, q.SessionToken) {
+		return nil
+	}
+	return &ValidationError{fmt.Sprintf(FmtErrQuestionSessionNotInEvent, q.SessionToken)}
+}
+
+// hasSession reports whether the
+// session is defined in event
+func hasSession(e *Event, sessionToken string) bool {
+	for _, session := range e.Sessions {
+		if session.SessionToken == sessionToken {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidatePoll(p *Poll, e *Event) error {
+	if len(strings.TrimSpace(p.Question)) == 0 {
+		return ErrPollQuestionEmpty
+	}
+	if len(p.Options) < 2 {
+		return ErrPollOptions
+	}
+	for _, option := range p.Options {
+		if len(strings.TrimSpace(option.Text)) == 0 {
+			return ErrPollOptions
+		}
+	}
+	if p.State != PollOpen && p.State != PollClosed {
+		return ErrPollState
+	}
+	if !hasSession(e, p.SessionToken) {
+		return &ValidationError{fmt.Sprintf(FmtErrQuestionSessionNotInEvent, p.SessionToken)}
+	}
+	return nil
+}
+
+func ValidatePrompt(p *Prompt, e *Event) error {
+	if len(strings.TrimSpace(p.Question)) == 0 {
+		return ErrPromptQuestionEmpty
+	}
+	if p.MaxWords < 1 || p.MaxWords > MaxPromptWords {
+		return ErrPromptMaxWords
+	}
+	if p.State != PollOpen && p.State != PollClosed {
+		return ErrPollState
+	}
+	if !hasSession(e, p.SessionToken) {
+		return &ValidationError{fmt.Sprintf(FmtErrQuestionSessionNotInEvent, p.SessionToken)}
+	}
+	return nil
+}
+
+func ValidateRating(r *Rating, e *Event) error {
+	if r.Stars < 1 || r.Stars > 5 {
+		return ErrRatingStars
+	}
+	if len([]rune(r.Comment)) > MaxCommentLength {
+		return ErrRatingComment
+	}
+	if !hasSession(e, r.SessionToken) {
+		return &ValidationError{fmt.Sprintf(FmtErrQuestionSessionNotInEvent, r.SessionToken)}
+	}
+	return nil
+}
+
+// ValidateChoices checks the choices
+// of client voting in poll
+func ValidateChoices(p *Poll, choices []int) error {
+	if len(choices) == 0 {
+		return ErrPollChoices
+	}
+	if !p.Multiple && len(choices) > 1 {
+		return ErrPollSingleChoice
+	}
+	seen := make(map[int]bool)
+	for _, choice := range choices {
+		if choice < 0 || choice >= len(p.Options) || seen[choice] {
+			return ErrPollChoices
+		}
+		seen[choice] = true
+	}
+	return nil
+}
+
 func ValidateEvent(e *Event) error {
 
 	if e.FromDate >= e.ToDate {
 		return ErrDateNotInSequence
 	}
 
+	for route, spec := range e.RateLimits {
+		if _, err := ParseRateLimit(spec); err != nil {
+			return fmt.Errorf(FmtErrRateLimitInvalid, route, spec)
+		}
+	}
+
+	switch e.ContentPolicy {
+	case "", ContentReject, ContentMask, ContentModerate:
+	default:
+		return fmt.Errorf(FmtErrContentPolicyUnknown, e.ContentPolicy)
+	}
+
 	// Prepare map to validate rooms
 	timeMap := make(map[string]int64)
 	for _, room := range e.Rooms {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -191,3 +192,51 @@ func TestValidateSessionSpeakers(t *testing.T) {
 	}
 
 }
+
+func TestValidateQuestion(t *testing.T) {
+	event := &Event{
+		Sessions: []Session{{Name: "Test session", SessionToken: "XYZ"}},
+	}
+
+	question := &Question{SessionToken: "XYZ", Question: "Why?"}
+	if err := ValidateQuestion(question, event); err != nil {
+		t.Error(err)
+	}
+
+	question.Question = "   "
+	if err := ValidateQuestion(question, event); err != ErrQuestionEmpty {
+		t.Error("Validator failed for empty question")
+	}
+
+	question.Question = strings.Repeat("ž", MaxQuestionLength)
+	if err := ValidateQuestion(question, event); err != nil {
+		t.Errorf("Validator failed for question of max length %v", err)
+	}
+	question.Question += "?"
+	if err := ValidateQuestion(question, event); err != ErrQuestionTooLong {
+		t.Error("Validator failed for too long question")
+	}
+
+	question.Question = "Why?"
+	question.SessionToken = "ABC"
+	if err := ValidateQuestion(question, event); err == nil {
+		t.Error("Validator failed for session not in event")
+	}
+}
+
+func TestValidateContentPolicy(t *testing.T) {
+	now := time.Now()
+	event := &Event{
+		Name:          "Open Zlin Fake Conference",
+		FromDate:      now.Unix(),
+		ToDate:        now.Add(time.Hour).Unix(),
+		ContentPolicy: ContentMask,
+	}
+	if err := ValidateEvent(event); err != nil {
+		t.Error(err)
+	}
+	event.ContentPolicy = "ignore"
+	if err := ValidateEvent(event); err == nil {
+		t.Error("Unknown content policy accepted")
+	}
+}